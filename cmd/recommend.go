@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	murre "github.com/groundcover-com/murre/pkg"
+	"github.com/groundcover-com/murre/pkg/config"
+	"github.com/groundcover-com/murre/pkg/k8s"
+	"github.com/groundcover-com/murre/pkg/recommend"
+	"github.com/spf13/cobra"
+)
+
+var (
+	recommendConfig *config.Recommend
+)
+
+func init() {
+	initRecommendFlags()
+	RootCmd.AddCommand(RecommendCmd)
+}
+
+var RecommendCmd = &cobra.Command{
+	Use:   "recommend",
+	Short: "suggest cpu and memory requests and limits based on the observed usage",
+	Long: `recommend watches the containers selected by the filters for a while and suggests
+requests based on a percentile of their usage plus headroom, and limits based on their
+maximal usage plus a margin. The replicas of a workload are combined, since they share the same spec`,
+	Args: cobra.NoArgs,
+	RunE: runRecommend,
+}
+
+func runRecommend(cmd *cobra.Command, args []string) error {
+	output, err := recommend.ParseOutput(recommendConfig.Output)
+	if err != nil {
+		return err
+	}
+
+	catalog, err := k8s.LoadCatalog(murreConfig.MetricsCatalog)
+	if err != nil {
+		return err
+	}
+
+	recommender, err := recommend.NewRecommender(*recommendConfig)
+	if err != nil {
+		return err
+	}
+
+	// the recommendations are made per workload, out of the samples the recommender keeps itself
+	murreConfig.ResolveWorkloads = true
+	murreConfig.History = 0
+	murre, err := murre.NewMurre(recommender, murreConfig, catalog)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprintf(os.Stderr, "Collecting usage for %s, press ctrl-c to stop early...\n", recommendConfig.Window)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- murre.Run()
+	}()
+
+	select {
+	case err := <-errCh:
+		// Run only returns before Stop when it failed to start
+		return err
+	case <-time.After(recommendConfig.Window):
+	case <-ctx.Done():
+	}
+	murre.Stop()
+
+	recommendations, err := recommender.Recommendations()
+	if err != nil {
+		return err
+	}
+	return recommend.Write(os.Stdout, recommendations, output)
+}
+
+func initRecommendFlags() {
+	recommendConfig = &config.Recommend{}
+	RecommendCmd.Flags().DurationVar(
+		&recommendConfig.Window,
+		"window",
+		config.DefaultRecommendWindow,
+		"how long to collect the usage for",
+	)
+	RecommendCmd.Flags().Float64Var(
+		&recommendConfig.Percentile,
+		"percentile",
+		config.DefaultRecommendPercentile,
+		"percentile of the usage to base the requests on",
+	)
+	RecommendCmd.Flags().Float64Var(
+		&recommendConfig.Headroom,
+		"headroom",
+		config.DefaultRecommendHeadroom,
+		"percent to add on top of the usage percentile for the requests",
+	)
+	RecommendCmd.Flags().Float64Var(
+		&recommendConfig.Margin,
+		"margin",
+		config.DefaultRecommendMargin,
+		"percent to add on top of the maximal usage for the limits, a cpu limit is only suggested for containers which have one",
+	)
+	RecommendCmd.Flags().StringVar(
+		&recommendConfig.Output,
+		"output",
+		config.DefaultRecommendOutput,
+		"output format (table, json, patch), patch prints a kubectl patch command per workload",
+	)
+}
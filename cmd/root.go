@@ -1,13 +1,16 @@
 package cmd
 
 import (
-	"path/filepath"
+	"fmt"
+	"strings"
 
+	"github.com/go-logr/logr"
 	murre "github.com/groundcover-com/murre/pkg"
 	"github.com/groundcover-com/murre/pkg/config"
+	"github.com/groundcover-com/murre/pkg/k8s"
 	"github.com/groundcover-com/murre/pkg/ui"
 	"github.com/spf13/cobra"
-	"k8s.io/client-go/util/homedir"
+	"k8s.io/klog/v2"
 )
 
 var (
@@ -32,46 +35,114 @@ func Execute() error {
 }
 
 func run(cmd *cobra.Command, args []string) error {
-	table := ui.CreateNewTable()
-	murre, err := murre.NewMurre(table, murreConfig)
+	catalog, err := k8s.LoadCatalog(murreConfig.MetricsCatalog)
 	if err != nil {
 		return err
 	}
 
+	columns := murreConfig.Columns
+	if murreConfig.IsMultiCluster() {
+		columns = append([]string{ui.COLUMN_CLUSTER}, columns...)
+	}
+
+	groupBy, err := k8s.ParseGroupBy(murreConfig.GroupBy)
+	if err != nil {
+		return err
+	}
+
+	table, err := ui.CreateNewTable(groupBy, columns, catalog)
+	if err != nil {
+		return err
+	}
+	if err := table.SetView(murreConfig.View); err != nil {
+		return err
+	}
+	murre, err := murre.NewMurre(table, murreConfig, catalog)
+	if err != nil {
+		return err
+	}
+
+	// client-go logs to stderr through klog, which would draw over the table.
+	// The errors murre cares about are shown in the status bar instead
+	klog.SetLogger(logr.Discard())
+	defer klog.ClearLogger()
+
 	go murre.Run()
 
-	table.Draw()
+	err = table.Draw()
 	murre.Stop()
 
-	return nil
+	return err
 }
 
 func initMurreFlags() {
 	murreConfig = &config.Config{}
-	RootCmd.Flags().DurationVar(
+	RootCmd.PersistentFlags().DurationVar(
 		&murreConfig.RefreshInterval,
 		"interval",
 		config.DefaultRefreshInterval,
 		"seconds to wait between updates",
 	)
-	RootCmd.Flags().StringVar(
+	RootCmd.PersistentFlags().IntVar(
+		&murreConfig.Concurrency,
+		"concurrency",
+		config.DefaultConcurrency,
+		"number of nodes to scrape in parallel",
+	)
+	RootCmd.PersistentFlags().DurationVar(
+		&murreConfig.NodeTimeout,
+		"node-timeout",
+		config.DefaultNodeTimeout,
+		"timeout for scraping a single node",
+	)
+	RootCmd.PersistentFlags().StringVar(
+		&murreConfig.Filters.Selector,
+		"selector",
+		"",
+		"filter pods by label selector, e.g. team=payments",
+	)
+	RootCmd.PersistentFlags().StringVar(
+		&murreConfig.Filters.FieldSelector,
+		"field-selector",
+		"",
+		"filter pods by field selector, e.g. status.phase=Running",
+	)
+	RootCmd.PersistentFlags().StringVar(
+		&murreConfig.Filters.NodeSelector,
+		"node-selector",
+		"",
+		"scrape only the nodes matching this label selector",
+	)
+	RootCmd.PersistentFlags().StringVar(
+		&murreConfig.Filters.Cluster,
+		"filter-cluster",
+		"",
+		"filter by cluster (kubeconfig context) when several clusters are monitored",
+	)
+	RootCmd.PersistentFlags().StringVar(
 		&murreConfig.Filters.Namespace,
 		"namespace",
 		"",
 		"filter by namespace",
 	)
-	RootCmd.Flags().StringVar(
+	RootCmd.PersistentFlags().StringVar(
 		&murreConfig.Filters.Pod,
 		"pod",
 		"",
 		"filter by pod",
 	)
-	RootCmd.Flags().StringVar(
+	RootCmd.PersistentFlags().StringVar(
 		&murreConfig.Filters.Container,
 		"container",
 		"",
 		"filter by container",
 	)
+	RootCmd.PersistentFlags().StringVar(
+		&murreConfig.Filters.Workload,
+		"workload",
+		"",
+		"filter by the workload managing the pods, e.g. Deployment/api",
+	)
 	RootCmd.Flags().BoolVar(
 		&murreConfig.SortBy.Cpu,
 		"sortby-cpu",
@@ -96,28 +167,181 @@ func initMurreFlags() {
 		false,
 		"sort by memory utilization",
 	)
+	RootCmd.Flags().BoolVar(
+		&murreConfig.SortBy.CpuRequestRatio,
+		"sortby-cpu-request-ratio",
+		false,
+		"sort by cpu usage against the cpu request",
+	)
+	RootCmd.Flags().BoolVar(
+		&murreConfig.SortBy.MemRequestRatio,
+		"sortby-mem-request-ratio",
+		false,
+		"sort by memory usage against the memory request",
+	)
 	RootCmd.Flags().BoolVar(
 		&murreConfig.SortBy.PodName,
 		"sortby-pod-name",
 		false,
 		"sort by pod name",
 	)
+	RootCmd.Flags().BoolVar(
+		&murreConfig.SortBy.Cluster,
+		"sortby-cluster",
+		false,
+		"sort by cluster (kubeconfig context)",
+	)
+	RootCmd.Flags().BoolVar(
+		&murreConfig.SortBy.CpuThrottling,
+		"sortby-cpu-throttling",
+		false,
+		"sort by cpu throttling",
+	)
+	RootCmd.Flags().BoolVar(
+		&murreConfig.SortBy.NetworkRx,
+		"sortby-net-rx",
+		false,
+		"sort by pod network received bytes",
+	)
+	RootCmd.Flags().BoolVar(
+		&murreConfig.SortBy.NetworkTx,
+		"sortby-net-tx",
+		false,
+		"sort by pod network transmitted bytes",
+	)
+	RootCmd.Flags().BoolVar(
+		&murreConfig.SortBy.NetworkDrops,
+		"sortby-net-drops",
+		false,
+		"sort by pod network dropped packets",
+	)
+	RootCmd.Flags().BoolVar(
+		&murreConfig.SortBy.FsReads,
+		"sortby-fs-reads",
+		false,
+		"sort by filesystem bytes read",
+	)
+	RootCmd.Flags().BoolVar(
+		&murreConfig.SortBy.FsWrites,
+		"sortby-fs-writes",
+		false,
+		"sort by filesystem bytes written",
+	)
+	RootCmd.Flags().BoolVar(
+		&murreConfig.SortBy.FsUsage,
+		"sortby-fs-usage",
+		false,
+		"sort by filesystem usage",
+	)
+	RootCmd.Flags().StringVar(
+		&murreConfig.SortBy.Metric,
+		"sortby-metric",
+		"",
+		"sort by a metric of the metrics catalog, given by its key",
+	)
+	RootCmd.PersistentFlags().StringVar(
+		&murreConfig.MemoryBasis,
+		"memory-basis",
+		config.DefaultMemoryBasis,
+		"memory metric to show and compare against the memory limit (working-set, usage, rss)",
+	)
+	RootCmd.Flags().DurationVar(
+		&murreConfig.History,
+		"history",
+		config.DefaultHistory,
+		"how far back to show the cpu and memory usage of every container as a sparkline, 0 to hide the sparklines",
+	)
+	RootCmd.Flags().StringVar(
+		&murreConfig.View,
+		"view",
+		config.DefaultView,
+		fmt.Sprintf("view to start with (%s), press n to switch views and enter to show the containers of a node", strings.Join(ui.Views, ", ")),
+	)
+	RootCmd.Flags().StringVar(
+		&murreConfig.GroupBy,
+		"group-by",
+		config.DefaultGroupBy,
+		"sum up the containers per container, pod, workload, namespace or node",
+	)
+	RootCmd.Flags().StringSliceVar(
+		&murreConfig.Columns,
+		"columns",
+		nil,
+		fmt.Sprintf("additional columns to show (%s) or keys of metrics catalog metrics", strings.Join(ui.OptionalColumns, ", ")),
+	)
+	RootCmd.PersistentFlags().StringVar(
+		&murreConfig.Source,
+		"source",
+		config.DefaultSource,
+		"where to read the metrics from (cadvisor, summary, metrics-server)",
+	)
+	RootCmd.PersistentFlags().BoolVar(
+		&murreConfig.MetricsServerFallback,
+		"metrics-server-fallback",
+		true,
+		"read the metrics from metrics-server when access to the kubelet proxy (nodes/proxy) is forbidden",
+	)
+	RootCmd.PersistentFlags().BoolVar(
+		&murreConfig.KubeletDirect,
+		"kubelet-direct",
+		false,
+		"connect to the kubelets directly instead of through the API server node proxy",
+	)
+	RootCmd.PersistentFlags().StringVar(
+		&murreConfig.KubeletTokenFile,
+		"kubelet-token-file",
+		"",
+		"file with a bearer token to authenticate to the kubelets with instead of the kubeconfig credentials (with --kubelet-direct)",
+	)
+	RootCmd.PersistentFlags().BoolVar(
+		&murreConfig.KubeletInsecureTLS,
+		"kubelet-insecure-tls",
+		false,
+		"do not verify the kubelet serving certificates (with --kubelet-direct)",
+	)
+	RootCmd.PersistentFlags().StringVar(
+		&murreConfig.MetricsCatalog,
+		"metrics-catalog",
+		"",
+		"path of a YAML or JSON file with additional metrics to read from cAdvisor",
+	)
 
-	if home := homedir.HomeDir(); home != "" {
-		RootCmd.Flags().StringVar(
-			&murreConfig.Kubeconfig,
-			"kubeconfig",
-			filepath.Join(home, ".kube", "config"),
-			"(optional) absolute path to the kubeconfig file",
-		)
-	} else {
-		RootCmd.Flags().StringVar(
-			&murreConfig.Kubeconfig,
-			"kubeconfig",
-			"",
-			"absolute path to the kubeconfig file",
-		)
-	}
+	RootCmd.PersistentFlags().StringVar(
+		&murreConfig.Kubeconfig,
+		"kubeconfig",
+		"",
+		fmt.Sprintf("(optional) path to the kubeconfig file, defaults to $%s or ~/.kube/config", config.KUBECONFIG_ENV_NAME),
+	)
+	RootCmd.PersistentFlags().StringSliceVar(
+		&murreConfig.Contexts,
+		"context",
+		nil,
+		"kubeconfig contexts to use instead of the current context, several contexts are monitored together",
+	)
+	RootCmd.PersistentFlags().BoolVar(
+		&murreConfig.AllContexts,
+		"all-contexts",
+		false,
+		"monitor every context of the kubeconfig together",
+	)
+	RootCmd.PersistentFlags().StringVar(
+		&murreConfig.Cluster,
+		"cluster",
+		"",
+		"kubeconfig cluster to use instead of the cluster of the context",
+	)
+	RootCmd.PersistentFlags().StringVar(
+		&murreConfig.User,
+		"user",
+		"",
+		"kubeconfig user to use instead of the user of the context",
+	)
+	RootCmd.PersistentFlags().StringVar(
+		&murreConfig.As,
+		"as",
+		"",
+		"user to impersonate",
+	)
 
 	RootCmd.Flags()
 }
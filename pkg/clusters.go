@@ -0,0 +1,175 @@
+package murre
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/groundcover-com/murre/pkg/k8s"
+)
+
+type cluster struct {
+	name    string
+	fetcher DataFetcher
+}
+
+// clusterFetcher runs one fetcher per cluster concurrently and tags everything
+// it returns with the cluster it came from. A failing cluster does not fail
+// the fetch as long as another cluster succeeds
+type clusterFetcher struct {
+	clusters []*cluster
+	// errors of clusters which could not be created, reported with all metrics since they never recover
+	buildErrors []error
+	// errors of clusters which failed to start, reported with the next metrics
+	startErrors []error
+	// more than one context is monitored, even if some of them could not be created
+	isMultiCluster bool
+}
+
+func newClusterFetcher(clusters []*cluster, buildErrors []error) *clusterFetcher {
+	return &clusterFetcher{
+		clusters:       clusters,
+		buildErrors:    buildErrors,
+		isMultiCluster: len(clusters)+len(buildErrors) > 1,
+	}
+}
+
+func (f *clusterFetcher) Start(stopCh <-chan struct{}) error {
+	errs := make([]error, len(f.clusters))
+	f.forEach(func(i int, c *cluster) {
+		errs[i] = f.wrapError(c, c.fetcher.Start(stopCh))
+	})
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			f.startErrors = append(f.startErrors, err)
+			failed++
+		}
+	}
+	if failed == len(f.clusters) {
+		return errs[0]
+	}
+	return nil
+}
+
+func (f *clusterFetcher) GetMetrics() (*k8s.FetchResult, error) {
+	results := make([]*k8s.FetchResult, len(f.clusters))
+	errs := make([]error, len(f.clusters))
+	f.forEach(func(i int, c *cluster) {
+		results[i], errs[i] = c.fetcher.GetMetrics()
+	})
+
+	merged := &k8s.FetchResult{
+		Errors: append(append([]error{}, f.buildErrors...), f.startErrors...),
+	}
+	f.startErrors = nil
+
+	var churn *k8s.NodeChurn
+	failed := 0
+	for i, c := range f.clusters {
+		if errs[i] != nil {
+			merged.Errors = append(merged.Errors, f.wrapError(c, errs[i]))
+			failed++
+			continue
+		}
+
+		result := results[i]
+		for _, node := range result.Metrics {
+			node.Cluster = c.name
+			merged.Metrics = append(merged.Metrics, node)
+		}
+		for _, health := range result.NodeHealth {
+			health.Cluster = c.name
+			health.LastError = f.wrapError(c, health.LastError)
+			merged.NodeHealth = append(merged.NodeHealth, health)
+		}
+		for _, node := range result.SkippedNodes {
+			node.Cluster = c.name
+			merged.SkippedNodes = append(merged.SkippedNodes, node)
+		}
+		for _, err := range result.Errors {
+			merged.Errors = append(merged.Errors, f.wrapError(c, err))
+		}
+		if result.NodeChurn != nil {
+			if churn == nil {
+				churn = &k8s.NodeChurn{Ts: result.NodeChurn.Ts}
+			}
+			churn.Added = append(churn.Added, f.nodeNames(c, result.NodeChurn.Added)...)
+			churn.Removed = append(churn.Removed, f.nodeNames(c, result.NodeChurn.Removed)...)
+		}
+		if merged.Source == "" {
+			merged.Source = result.Source
+		}
+		if result.FallbackFrom != "" {
+			merged.Source = result.Source
+			merged.FallbackFrom = result.FallbackFrom
+		}
+	}
+	merged.NodeChurn = churn
+
+	if failed == len(f.clusters) {
+		return nil, merged.Errors[len(merged.Errors)-1]
+	}
+	return merged, nil
+}
+
+func (f *clusterFetcher) GetContainers() ([]*k8s.ContainerResources, error) {
+	containers := make([]*k8s.ContainerResources, 0)
+	for _, c := range f.clusters {
+		clusterContainers, err := c.fetcher.GetContainers()
+		if err != nil {
+			return nil, f.wrapError(c, err)
+		}
+		for _, container := range clusterContainers {
+			container.Cluster = c.name
+		}
+		containers = append(containers, clusterContainers...)
+	}
+	return containers, nil
+}
+
+func (f *clusterFetcher) GetNodes() ([]*k8s.NodeResources, error) {
+	nodes := make([]*k8s.NodeResources, 0)
+	for _, c := range f.clusters {
+		clusterNodes, err := c.fetcher.GetNodes()
+		if err != nil {
+			return nil, f.wrapError(c, err)
+		}
+		for _, node := range clusterNodes {
+			node.Cluster = c.name
+		}
+		nodes = append(nodes, clusterNodes...)
+	}
+	return nodes, nil
+}
+
+func (f *clusterFetcher) forEach(fn func(i int, c *cluster)) {
+	var wg sync.WaitGroup
+	for i, c := range f.clusters {
+		wg.Add(1)
+		go func(i int, c *cluster) {
+			defer wg.Done()
+			fn(i, c)
+		}(i, c)
+	}
+	wg.Wait()
+}
+
+// wrapError names the cluster an error belongs to, unless a single cluster is monitored
+func (f *clusterFetcher) wrapError(c *cluster, err error) error {
+	if err == nil || !f.isMultiCluster {
+		return err
+	}
+	return fmt.Errorf("cluster %s: %w", c.name, err)
+}
+
+func (f *clusterFetcher) nodeNames(c *cluster, nodes []string) []string {
+	if !f.isMultiCluster {
+		return nodes
+	}
+	names := make([]string, len(nodes))
+	for i, node := range nodes {
+		names[i] = c.name + "/" + node
+	}
+	return names
+}
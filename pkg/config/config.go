@@ -5,20 +5,44 @@ import (
 )
 
 const (
-	KUBECONFIG_ENV_NAME = "kubeconfig"
+	// list of kubeconfig files, merged the same way kubectl does
+	KUBECONFIG_ENV_NAME = "KUBECONFIG"
 )
 
 var (
 	DefaultRefreshInterval = time.Second * 5
+	DefaultConcurrency     = 20
+	DefaultNodeTimeout     = time.Second * 4
+	DefaultMemoryBasis     = "working-set"
+	DefaultSource          = "cadvisor"
+	DefaultGroupBy         = "container"
+	DefaultView            = "containers"
+	DefaultHistory         = time.Minute
+
+	DefaultRecommendWindow     = time.Minute * 10
+	DefaultRecommendPercentile = 95.0
+	DefaultRecommendHeadroom   = 15.0
+	DefaultRecommendMargin     = 20.0
+	DefaultRecommendOutput     = "table"
 )
 
 type Filter struct {
+	// label selector of the pods, evaluated by the API server
+	Selector string
+	// field selector of the pods, evaluated by the API server
+	FieldSelector string
+	// label selector of the nodes, evaluated by the API server
+	NodeSelector string
+	// filter by cluster (kubeconfig context)
+	Cluster string
 	// filter by namespace
 	Namespace string
 	// filter by pod
 	Pod string
 	// filter by container
 	Container string
+	// filter by the workload managing the pods, e.g. Deployment/api
+	Workload string
 }
 
 type SortBy struct {
@@ -30,13 +54,93 @@ type SortBy struct {
 	Mem bool
 	// sort by memory utilization
 	MemUtilization bool
+	// sort by cpu usage against the cpu request
+	CpuRequestRatio bool
+	// sort by memory usage against the memory request
+	MemRequestRatio bool
 	// sort by pod name
 	PodName bool
+	// sort by cluster (kubeconfig context)
+	Cluster bool
+	// sort by the share of throttled cpu periods
+	CpuThrottling bool
+	// sort by pod network received bytes
+	NetworkRx bool
+	// sort by pod network transmitted bytes
+	NetworkTx bool
+	// sort by pod network dropped packets
+	NetworkDrops bool
+	// sort by filesystem bytes read
+	FsReads bool
+	// sort by filesystem bytes written
+	FsWrites bool
+	// sort by filesystem usage
+	FsUsage bool
+	// sort by the metric of the metrics catalog with this key
+	Metric string
 }
 
 type Config struct {
 	RefreshInterval time.Duration
-	Filters         Filter
-	SortBy          SortBy
-	Kubeconfig      string
+	// number of nodes scraped in parallel
+	Concurrency int
+	// timeout for scraping a single node
+	NodeTimeout time.Duration
+	Filters     Filter
+	SortBy      SortBy
+	// memory metric compared against the memory limit (working-set, usage or rss)
+	MemoryBasis string
+	// what the containers are summed up to (container, pod, workload, namespace or node)
+	GroupBy string
+	// view shown at startup (containers or nodes)
+	View string
+	// how far back the usage of every container is kept for the sparklines, 0 disables them
+	History time.Duration
+	// attribute the pods of ReplicaSets and Jobs to their Deployments and CronJobs
+	// even when the containers are not grouped by workload
+	ResolveWorkloads bool
+	// additional table columns to show
+	Columns []string
+	// path of a metrics catalog file extending the default catalog
+	MetricsCatalog string
+	// where the metrics are read from (cadvisor, summary or metrics-server)
+	Source string
+	// read the metrics from metrics-server when access to the kubelet proxy is forbidden
+	MetricsServerFallback bool
+	// connect to the kubelets directly instead of through the API server node proxy
+	KubeletDirect bool
+	// bearer token used for the kubelets instead of the kubeconfig credentials
+	KubeletTokenFile string
+	// skip verifying the kubelet serving certificates
+	KubeletInsecureTLS bool
+	// path of the kubeconfig file, $KUBECONFIG or ~/.kube/config when empty
+	Kubeconfig string
+	// kubeconfig contexts to monitor together, the current context when empty
+	Contexts []string
+	// monitor every context of the kubeconfig
+	AllContexts bool
+	// kubeconfig cluster and user to use instead of the ones of the context
+	Cluster string
+	User    string
+	// user to impersonate
+	As string
+}
+
+// Recommend configures the murre recommend command
+type Recommend struct {
+	// how long the usage is collected for
+	Window time.Duration
+	// percentile of the usage the requests are based on
+	Percentile float64
+	// percent added on top of the usage percentile for the requests
+	Headroom float64
+	// percent added on top of the maximal usage for the limits
+	Margin float64
+	// output format (table, json or patch)
+	Output string
+}
+
+// IsMultiCluster reports whether several clusters are monitored together
+func (c *Config) IsMultiCluster() bool {
+	return c.AllContexts || len(c.Contexts) > 1
 }
@@ -0,0 +1,416 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	CACHE_RESYNC_PERIOD      = 10 * time.Minute
+	CACHE_SYNC_TIMEOUT       = time.Minute
+	CACHE_SYNC_POLL_INTERVAL = 100 * time.Millisecond
+)
+
+// Selectors limit the pods and nodes which are watched. They are evaluated by the
+// API server, so pods and nodes which do not match are never sent to murre
+type Selectors struct {
+	// label selector of the pods
+	Pod string
+	// field selector of the pods, e.g. status.phase=Running
+	PodField string
+	// label selector of the nodes
+	Node string
+}
+
+// Validate checks the syntax of the selectors, so that mistakes are reported
+// before the watches start
+func (s Selectors) Validate() error {
+	if _, err := labels.Parse(s.Pod); err != nil {
+		return fmt.Errorf("invalid pod selector: %w", err)
+	}
+	if _, err := fields.ParseSelector(s.PodField); err != nil {
+		return fmt.Errorf("invalid field selector: %w", err)
+	}
+	if _, err := labels.Parse(s.Node); err != nil {
+		return fmt.Errorf("invalid node selector: %w", err)
+	}
+	return nil
+}
+
+func (s Selectors) selectsPods() bool {
+	return s.Pod != "" || s.PodField != ""
+}
+
+type SpecCacheOptions struct {
+	Selectors Selectors
+	// watch ReplicaSets and Jobs as well, to resolve the Deployments and CronJobs owning the pods
+	ResolveWorkloads bool
+	// namespace of the pods murre shows, the workloads are watched in it only. Empty for all namespaces
+	Namespace string
+}
+
+// SpecCache keeps an up to date copy of the pods and nodes of the cluster,
+// fed by watches instead of listing them over and over again
+type SpecCache struct {
+	// pods and nodes are listed with different selectors, which apply to all the informers of a factory
+	podFactory  informers.SharedInformerFactory
+	nodeFactory informers.SharedInformerFactory
+	selectors   Selectors
+	podLister   corelisters.PodLister
+	nodeLister  corelisters.NodeLister
+	podsSynced  cache.InformerSynced
+	nodesSynced cache.InformerSynced
+	// nil unless ResolveWorkloads is set
+	workloadFactory  informers.SharedInformerFactory
+	replicaSetLister appslisters.ReplicaSetLister
+	jobLister        batchlisters.JobLister
+	workloadsSynced  []cache.InformerSynced
+	mu               sync.Mutex
+	// errors of the watches which were not taken by WatchErrors yet
+	watchErrors []error
+	// last error of the pod and node watches, Start fails with it
+	syncError error
+}
+
+func NewSpecCache(clientset kubernetes.Interface, options SpecCacheOptions) *SpecCache {
+	selectors := options.Selectors
+	podFactory := informers.NewSharedInformerFactoryWithOptions(clientset, CACHE_RESYNC_PERIOD,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = selectors.Pod
+			options.FieldSelector = selectors.PodField
+		}),
+	)
+	nodeFactory := informers.NewSharedInformerFactoryWithOptions(clientset, CACHE_RESYNC_PERIOD,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = selectors.Node
+		}),
+	)
+
+	podInformer := podFactory.Core().V1().Pods()
+	nodeInformer := nodeFactory.Core().V1().Nodes()
+	podInformer.Informer().SetTransform(stripManagedFields)
+	nodeInformer.Informer().SetTransform(stripManagedFields)
+
+	c := &SpecCache{
+		podFactory:  podFactory,
+		nodeFactory: nodeFactory,
+		selectors:   selectors,
+		podLister:   podInformer.Lister(),
+		nodeLister:  nodeInformer.Lister(),
+		podsSynced:  podInformer.Informer().HasSynced,
+		nodesSynced: nodeInformer.Informer().HasSynced,
+	}
+	// setting the handler only fails once the informers were started
+	_ = podInformer.Informer().SetWatchErrorHandler(c.handleWatchError("pods", true))
+	_ = nodeInformer.Informer().SetWatchErrorHandler(c.handleWatchError("nodes", true))
+
+	if options.ResolveWorkloads {
+		c.workloadFactory = informers.NewSharedInformerFactoryWithOptions(clientset, CACHE_RESYNC_PERIOD,
+			informers.WithNamespace(options.Namespace),
+		)
+		replicaSetInformer := c.workloadFactory.Apps().V1().ReplicaSets()
+		jobInformer := c.workloadFactory.Batch().V1().Jobs()
+		replicaSetInformer.Informer().SetTransform(stripSpecAndStatus)
+		jobInformer.Informer().SetTransform(stripSpecAndStatus)
+		_ = replicaSetInformer.Informer().SetWatchErrorHandler(c.handleWatchError("replicasets", false))
+		_ = jobInformer.Informer().SetWatchErrorHandler(c.handleWatchError("jobs", false))
+		c.replicaSetLister = replicaSetInformer.Lister()
+		c.jobLister = jobInformer.Lister()
+		c.workloadsSynced = []cache.InformerSynced{replicaSetInformer.Informer().HasSynced, jobInformer.Informer().HasSynced}
+	}
+	return c
+}
+
+// Start runs the watches until stopCh is closed and waits for the initial listing of the pods
+// and nodes to complete. The workloads are not waited for, since murre works without them
+// (e.g. when it may not list ReplicaSets) and they are listed within the first refreshes anyway
+func (c *SpecCache) Start(stopCh <-chan struct{}) error {
+	c.podFactory.Start(stopCh)
+	c.nodeFactory.Start(stopCh)
+	if c.workloadFactory != nil {
+		c.workloadFactory.Start(stopCh)
+	}
+	synced := []cache.InformerSynced{c.podsSynced, c.nodesSynced}
+
+	ctx, cancel := context.WithTimeout(context.Background(), CACHE_SYNC_TIMEOUT)
+	defer cancel()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// a failed listing, e.g. forbidden by RBAC, is retried by the informers forever,
+	// so the first error is returned instead of waiting for the timeout
+	err := wait.PollImmediateUntilWithContext(ctx, CACHE_SYNC_POLL_INTERVAL, func(context.Context) (bool, error) {
+		if isSynced(synced) {
+			return true, nil
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return false, c.syncError
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("timed out waiting for the pods and nodes to be listed")
+	}
+	return err
+}
+
+func isSynced(synced []cache.InformerSynced) bool {
+	for _, hasSynced := range synced {
+		if !hasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// handleWatchError records the errors of the watches of a resource. They take the place of
+// the default handler of client-go, which logs them to stderr on top of the table.
+// The errors of the required resources fail Start
+func (c *SpecCache) handleWatchError(resource string, required bool) cache.WatchErrorHandler {
+	return func(r *cache.Reflector, err error) {
+		switch {
+		case apierrors.IsResourceExpired(err) || apierrors.IsGone(err):
+			// the watch is restarted from a fresh listing
+			return
+		case err == io.EOF || err == io.ErrUnexpectedEOF:
+			// the watch was closed, e.g. by a timeout of the API server, and is restarted
+			return
+		}
+
+		err = fmt.Errorf("failed to watch %s: %w", resource, err)
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.watchErrors = append(c.watchErrors, err)
+		if required {
+			c.syncError = err
+		}
+	}
+}
+
+// WatchErrors returns the errors of the watches since the previous call. The watches retry
+// by themselves, the errors are only reported
+func (c *SpecCache) WatchErrors() []error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	errs := c.watchErrors
+	c.watchErrors = nil
+	return errs
+}
+
+func (c *SpecCache) Pods() ([]*v1.Pod, error) {
+	return c.podLister.List(labels.Everything())
+}
+
+func (c *SpecCache) Nodes() ([]*v1.Node, error) {
+	return c.nodeLister.List(labels.Everything())
+}
+
+func (c *SpecCache) Node(name string) (*v1.Node, error) {
+	return c.nodeLister.Get(name)
+}
+
+// FilterSamples drops the samples of pods which are not cached because they do not match
+// the pod selectors, since the kubelets report the metrics of all the pods of their node.
+// With a node selector it also drops the samples of pods on nodes which are not cached,
+// since metrics-server reports the metrics of the pods of all nodes
+func (c *SpecCache) FilterSamples(metrics *Metrics) {
+	if !c.selectors.selectsPods() && c.selectors.Node == "" {
+		return
+	}
+	metrics.Containers = c.filterSamples(metrics.Containers)
+	metrics.Pods = c.filterSamples(metrics.Pods)
+}
+
+func (c *SpecCache) filterSamples(samples []*Sample) []*Sample {
+	filtered := samples[:0]
+	for _, sample := range samples {
+		pod, err := c.podLister.Pods(sample.Namespace).Get(sample.PodName)
+		if err != nil {
+			continue
+		}
+		if c.selectors.Node != "" {
+			if _, err := c.nodeLister.Get(pod.Spec.NodeName); err != nil {
+				continue
+			}
+		}
+		filtered = append(filtered, sample)
+	}
+	return filtered
+}
+
+// Containers returns the requests and limits of every container of the cached pods
+func (c *SpecCache) Containers() ([]*ContainerResources, error) {
+	pods, err := c.Pods()
+	if err != nil {
+		return nil, err
+	}
+	containers := make([]*ContainerResources, 0)
+	for _, pod := range pods {
+		workload := c.workload(pod)
+		for _, container := range pod.Spec.Containers {
+			requestCpu := container.Resources.Requests.Cpu()
+			requestMemory := container.Resources.Requests.Memory()
+			limitCpu := container.Resources.Limits.Cpu()
+			limitMemory := container.Resources.Limits.Memory()
+			containerResource := &ContainerResources{
+				PodName:   pod.Name,
+				Name:      container.Name,
+				Namespace: pod.Namespace,
+				Image:     container.Image,
+				NodeName:  pod.Spec.NodeName,
+				Workload:  workload,
+				Request: Resources{
+					Cpu:    0,
+					Memory: 0,
+				},
+				Limit: Resources{
+					Cpu:    0,
+					Memory: 0,
+				},
+			}
+			if requestCpu != nil {
+				containerResource.Request.Cpu = float64(requestCpu.MilliValue())
+			}
+
+			if requestMemory != nil {
+				containerResource.Request.Memory = float64(requestMemory.Value())
+			}
+			if limitCpu != nil {
+				containerResource.Limit.Cpu = float64(limitCpu.MilliValue())
+			}
+			if limitMemory != nil {
+				containerResource.Limit.Memory = float64(limitMemory.Value())
+			}
+
+			containers = append(containers, containerResource)
+		}
+	}
+	return containers, nil
+}
+
+// NodeResources returns the capacity of every cached node along with the requests, limits
+// and number of the running pods scheduled to it. With pod selectors only the selected pods count
+func (c *SpecCache) NodeResources() ([]*NodeResources, error) {
+	nodes, err := c.Nodes()
+	if err != nil {
+		return nil, err
+	}
+	pods, err := c.Pods()
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*NodeResources, len(nodes))
+	resources := make([]*NodeResources, 0, len(nodes))
+	for _, node := range nodes {
+		r := &NodeResources{
+			Name:        node.Name,
+			Capacity:    resourcesOf(node.Status.Capacity),
+			Allocatable: resourcesOf(node.Status.Allocatable),
+		}
+		byName[node.Name] = r
+		resources = append(resources, r)
+	}
+
+	for _, pod := range pods {
+		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		r, ok := byName[pod.Spec.NodeName]
+		if !ok {
+			continue
+		}
+		r.Pods++
+		for _, container := range pod.Spec.Containers {
+			request := resourcesOf(container.Resources.Requests)
+			limit := resourcesOf(container.Resources.Limits)
+			r.Request.Cpu += request.Cpu
+			r.Request.Memory += request.Memory
+			r.Limit.Cpu += limit.Cpu
+			r.Limit.Memory += limit.Memory
+		}
+	}
+	return resources, nil
+}
+
+// resourcesOf returns the cpu in millicores and the memory in bytes of a resource list
+func resourcesOf(list v1.ResourceList) Resources {
+	return Resources{
+		Cpu:    float64(list.Cpu().MilliValue()),
+		Memory: float64(list.Memory().Value()),
+	}
+}
+
+// workload returns the kind and name of the workload which manages the pod, e.g. Deployment/api.
+// Pods of ReplicaSets and Jobs are attributed to the Deployments and CronJobs owning them
+// when the workloads are resolved and listed, otherwise to the ReplicaSets and Jobs themselves.
+// Pods without a controller are workloads of their own
+func (c *SpecCache) workload(pod *v1.Pod) string {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return "Pod/" + pod.Name
+	}
+
+	if c.workloadFactory != nil && isSynced(c.workloadsSynced) {
+		var parent *metav1.OwnerReference
+		switch owner.Kind {
+		case "ReplicaSet":
+			if replicaSet, err := c.replicaSetLister.ReplicaSets(pod.Namespace).Get(owner.Name); err == nil {
+				parent = metav1.GetControllerOf(replicaSet)
+			}
+		case "Job":
+			if job, err := c.jobLister.Jobs(pod.Namespace).Get(owner.Name); err == nil {
+				parent = metav1.GetControllerOf(job)
+			}
+		}
+		if parent != nil {
+			owner = parent
+		}
+	}
+	return owner.Kind + "/" + owner.Name
+}
+
+// stripSpecAndStatus keeps only the metadata of cached workloads, which is all murre needs to resolve owners
+func stripSpecAndStatus(obj interface{}) (interface{}, error) {
+	switch o := obj.(type) {
+	case *appsv1.ReplicaSet:
+		o.Spec = appsv1.ReplicaSetSpec{}
+		o.Status = appsv1.ReplicaSetStatus{}
+	case *batchv1.Job:
+		o.Spec = batchv1.JobSpec{}
+		o.Status = batchv1.JobStatus{}
+	}
+	return stripManagedFields(obj)
+}
+
+// stripManagedFields drops the managed fields of cached objects,
+// murre never reads them and on large clusters they take most of the memory
+func stripManagedFields(obj interface{}) (interface{}, error) {
+	if accessor, err := meta.Accessor(obj); err == nil {
+		accessor.SetManagedFields(nil)
+	}
+	return obj, nil
+}
@@ -0,0 +1,126 @@
+package k8s
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestSpecCacheStartReturnsListErrors(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "", nil)
+	})
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	start := time.Now()
+	err := NewSpecCache(clientset, SpecCacheOptions{}).Start(stopCh)
+	if !apierrors.IsForbidden(err) {
+		t.Fatalf("got error %v, want forbidden", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("took %s to fail", elapsed)
+	}
+}
+
+func ownedBy(kind, name string) []metav1.OwnerReference {
+	isController := true
+	return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &isController}}
+}
+
+func TestSpecCacheResolvesWorkloads(t *testing.T) {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "api-1", Namespace: "shop", OwnerReferences: ownedBy("ReplicaSet", "api-5d8f")}}
+	replicaSet := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "api-5d8f", Namespace: "shop", OwnerReferences: ownedBy("Deployment", "api")}}
+
+	tests := []struct {
+		name string
+		// the replicasets and jobs may not be listed
+		forbidden bool
+		want      string
+	}{
+		{name: "owner of the replicaset", want: "Deployment/api"},
+		{name: "replicasets forbidden", forbidden: true, want: "ReplicaSet/api-5d8f"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(pod, replicaSet)
+			if test.forbidden {
+				for _, resource := range []string{"replicasets", "jobs"} {
+					clientset.PrependReactor("list", resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+						return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: action.GetResource().Resource}, "", nil)
+					})
+				}
+			}
+			stopCh := make(chan struct{})
+			defer close(stopCh)
+
+			specCache := NewSpecCache(clientset, SpecCacheOptions{ResolveWorkloads: true, Namespace: "shop"})
+			if err := specCache.Start(stopCh); err != nil {
+				t.Fatal(err)
+			}
+			if !test.forbidden {
+				// the workloads are not waited for by Start
+				if !cache.WaitForCacheSync(stopCh, specCache.workloadsSynced...) {
+					t.Fatal("the workloads were not listed")
+				}
+			}
+
+			containers, err := specCache.Containers()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, container := range containers {
+				if container.Workload != test.want {
+					t.Errorf("got workload %q, want %q", container.Workload, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterSamplesByNodeSelector(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a", Labels: map[string]string{"pool": "web"}}},
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-b", Labels: map[string]string{"pool": "batch"}}},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "api-1", Namespace: "shop"}, Spec: v1.PodSpec{NodeName: "node-a"}},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "report-1", Namespace: "shop"}, Spec: v1.PodSpec{NodeName: "node-b"}},
+	)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	specCache := NewSpecCache(clientset, SpecCacheOptions{Selectors: Selectors{Node: "pool=web"}})
+	if err := specCache.Start(stopCh); err != nil {
+		t.Fatal(err)
+	}
+
+	// metrics-server reports the pods of all nodes
+	metrics := &Metrics{
+		Containers: []*Sample{
+			{Name: "app", PodName: "api-1", Namespace: "shop"},
+			{Name: "app", PodName: "report-1", Namespace: "shop"},
+			{Name: "app", PodName: "unknown-1", Namespace: "shop"},
+		},
+		Pods: []*Sample{
+			{PodName: "api-1", Namespace: "shop"},
+			{PodName: "report-1", Namespace: "shop"},
+		},
+	}
+	specCache.FilterSamples(metrics)
+
+	for _, samples := range [][]*Sample{metrics.Containers, metrics.Pods} {
+		if len(samples) != 1 || samples[0].PodName != "api-1" {
+			t.Errorf("got samples %+v, want only the samples of api-1", samples)
+		}
+	}
+}
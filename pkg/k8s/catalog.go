@@ -0,0 +1,249 @@
+package k8s
+
+import (
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// MetricKind tells whether a metric is rated per second or shown as is
+type MetricKind string
+
+const (
+	METRIC_KIND_COUNTER MetricKind = "counter"
+	METRIC_KIND_GAUGE   MetricKind = "gauge"
+)
+
+// MetricLevel tells whether a metric is reported per container or for the pod sandbox
+type MetricLevel string
+
+const (
+	METRIC_LEVEL_CONTAINER MetricLevel = "container"
+	METRIC_LEVEL_POD       MetricLevel = "pod"
+)
+
+const (
+	METRIC_UNIT_CORES   = "cores"
+	METRIC_UNIT_BYTES   = "bytes"
+	METRIC_UNIT_SECONDS = "seconds"
+	METRIC_UNIT_PACKETS = "packets"
+	METRIC_UNIT_PERIODS = "periods"
+)
+
+// keys of the built-in metrics, murre computes the stats it shows out of these
+const (
+	METRIC_CPU_USAGE                 = "cpu_usage"
+	METRIC_CPU_USER                  = "cpu_user"
+	METRIC_CPU_SYSTEM                = "cpu_system"
+	METRIC_CPU_CFS_PERIODS           = "cpu_cfs_periods"
+	METRIC_CPU_CFS_THROTTLED_PERIODS = "cpu_cfs_throttled_periods"
+	METRIC_CPU_CFS_THROTTLED_SECONDS = "cpu_cfs_throttled_seconds"
+	METRIC_MEM_USAGE                 = "memory_usage"
+	METRIC_MEM_WORKING_SET           = "memory_working_set"
+	METRIC_MEM_RSS                   = "memory_rss"
+	METRIC_MEM_CACHE                 = "memory_cache"
+	METRIC_NET_RX_BYTES              = "network_rx_bytes"
+	METRIC_NET_TX_BYTES              = "network_tx_bytes"
+	METRIC_NET_RX_PACKETS            = "network_rx_packets"
+	METRIC_NET_TX_PACKETS            = "network_tx_packets"
+	METRIC_NET_RX_DROPPED            = "network_rx_dropped"
+	METRIC_NET_TX_DROPPED            = "network_tx_dropped"
+	METRIC_FS_READS                  = "fs_reads"
+	METRIC_FS_WRITES                 = "fs_writes"
+	METRIC_FS_USAGE                  = "fs_usage"
+)
+
+const (
+	METRIC_POD_LABEL        = "pod"
+	METRIC_CONTAINER_LABEL  = "container"
+	METRIC_NAME_LABEL       = "name"
+	METRICS_NAMESPACE_LABEL = "namespace"
+	METRICS_ID_LABEL        = "id"
+	METRICS_IMAGE_LABEL     = "image"
+	METRICS_CPU_LABEL       = "cpu"
+	METRICS_CPU_TOTAL       = "total"
+	METRICS_INTERFACE_LABEL = "interface"
+	METRICS_DEVICE_LABEL    = "device"
+)
+
+// MetricDefinition describes a single cAdvisor series murre reads
+type MetricDefinition struct {
+	// name the metric is referred to by, e.g. in --columns and --sortby-metric
+	Key string `json:"key"`
+	// name of the cAdvisor series
+	Series string      `json:"series"`
+	Kind   MetricKind  `json:"kind"`
+	Level  MetricLevel `json:"level,omitempty"`
+	// unit of the series, bytes are shown in MiB and counters are shown per second
+	Unit string `json:"unit,omitempty"`
+	// column title
+	Display string `json:"display,omitempty"`
+	// samples whose labels are set to a different value are skipped,
+	// samples of a container which differ in any other label are summed up
+	Match map[string]string `json:"match,omitempty"`
+}
+
+// LabelNames are the names of the labels identifying the container of a sample
+type LabelNames struct {
+	Pod       string `json:"pod,omitempty"`
+	Container string `json:"container,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Image     string `json:"image,omitempty"`
+}
+
+// MetricCatalog describes which cAdvisor series murre reads and how
+type MetricCatalog struct {
+	Labels LabelNames `json:"labels,omitempty"`
+	// labels which are expected and not needed, any other label is reported as a parse warning
+	IgnoredLabels []string            `json:"ignoredLabels,omitempty"`
+	Metrics       []*MetricDefinition `json:"metrics"`
+	bySeries      map[string][]*MetricDefinition
+	byKey         map[string]*MetricDefinition
+}
+
+func DefaultCatalog() *MetricCatalog {
+	cpuTotal := map[string]string{METRICS_CPU_LABEL: METRICS_CPU_TOTAL}
+	catalog := &MetricCatalog{
+		Labels: LabelNames{
+			Pod:       METRIC_POD_LABEL,
+			Container: METRIC_CONTAINER_LABEL,
+			Namespace: METRICS_NAMESPACE_LABEL,
+			Image:     METRICS_IMAGE_LABEL,
+		},
+		IgnoredLabels: []string{METRIC_NAME_LABEL, METRICS_ID_LABEL, METRICS_INTERFACE_LABEL, METRICS_DEVICE_LABEL},
+		Metrics: []*MetricDefinition{
+			// older cAdvisor versions may break the usage down per cpu core
+			{Key: METRIC_CPU_USAGE, Series: "container_cpu_usage_seconds_total", Kind: METRIC_KIND_COUNTER, Unit: METRIC_UNIT_CORES, Display: "CPU Usage", Match: cpuTotal},
+			{Key: METRIC_CPU_USER, Series: "container_cpu_user_seconds_total", Kind: METRIC_KIND_COUNTER, Unit: METRIC_UNIT_CORES, Display: "CPU User"},
+			{Key: METRIC_CPU_SYSTEM, Series: "container_cpu_system_seconds_total", Kind: METRIC_KIND_COUNTER, Unit: METRIC_UNIT_CORES, Display: "CPU System"},
+			// CFS bandwidth control, only reported for containers with a cpu limit
+			{Key: METRIC_CPU_CFS_PERIODS, Series: "container_cpu_cfs_periods_total", Kind: METRIC_KIND_COUNTER, Unit: METRIC_UNIT_PERIODS, Display: "CFS Periods"},
+			{Key: METRIC_CPU_CFS_THROTTLED_PERIODS, Series: "container_cpu_cfs_throttled_periods_total", Kind: METRIC_KIND_COUNTER, Unit: METRIC_UNIT_PERIODS, Display: "CFS Throttled Periods"},
+			{Key: METRIC_CPU_CFS_THROTTLED_SECONDS, Series: "container_cpu_cfs_throttled_seconds_total", Kind: METRIC_KIND_COUNTER, Unit: METRIC_UNIT_SECONDS, Display: "CFS Throttled Time"},
+			{Key: METRIC_MEM_USAGE, Series: "container_memory_usage_bytes", Kind: METRIC_KIND_GAUGE, Unit: METRIC_UNIT_BYTES, Display: "Mem Usage"},
+			{Key: METRIC_MEM_WORKING_SET, Series: "container_memory_working_set_bytes", Kind: METRIC_KIND_GAUGE, Unit: METRIC_UNIT_BYTES, Display: "Mem Working Set"},
+			{Key: METRIC_MEM_RSS, Series: "container_memory_rss", Kind: METRIC_KIND_GAUGE, Unit: METRIC_UNIT_BYTES, Display: "Mem RSS"},
+			{Key: METRIC_MEM_CACHE, Series: "container_memory_cache", Kind: METRIC_KIND_GAUGE, Unit: METRIC_UNIT_BYTES, Display: "Mem Cache"},
+			// network metrics are reported for the pod sandbox, not for each container
+			{Key: METRIC_NET_RX_BYTES, Series: "container_network_receive_bytes_total", Kind: METRIC_KIND_COUNTER, Level: METRIC_LEVEL_POD, Unit: METRIC_UNIT_BYTES, Display: "Pod Net RX Bytes"},
+			{Key: METRIC_NET_TX_BYTES, Series: "container_network_transmit_bytes_total", Kind: METRIC_KIND_COUNTER, Level: METRIC_LEVEL_POD, Unit: METRIC_UNIT_BYTES, Display: "Pod Net TX Bytes"},
+			{Key: METRIC_NET_RX_PACKETS, Series: "container_network_receive_packets_total", Kind: METRIC_KIND_COUNTER, Level: METRIC_LEVEL_POD, Unit: METRIC_UNIT_PACKETS, Display: "Pod Net RX Packets"},
+			{Key: METRIC_NET_TX_PACKETS, Series: "container_network_transmit_packets_total", Kind: METRIC_KIND_COUNTER, Level: METRIC_LEVEL_POD, Unit: METRIC_UNIT_PACKETS, Display: "Pod Net TX Packets"},
+			{Key: METRIC_NET_RX_DROPPED, Series: "container_network_receive_packets_dropped_total", Kind: METRIC_KIND_COUNTER, Level: METRIC_LEVEL_POD, Unit: METRIC_UNIT_PACKETS, Display: "Pod Net RX Dropped"},
+			{Key: METRIC_NET_TX_DROPPED, Series: "container_network_transmit_packets_dropped_total", Kind: METRIC_KIND_COUNTER, Level: METRIC_LEVEL_POD, Unit: METRIC_UNIT_PACKETS, Display: "Pod Net TX Dropped"},
+			{Key: METRIC_FS_READS, Series: "container_fs_reads_bytes_total", Kind: METRIC_KIND_COUNTER, Unit: METRIC_UNIT_BYTES, Display: "FS Reads"},
+			{Key: METRIC_FS_WRITES, Series: "container_fs_writes_bytes_total", Kind: METRIC_KIND_COUNTER, Unit: METRIC_UNIT_BYTES, Display: "FS Writes"},
+			{Key: METRIC_FS_USAGE, Series: "container_fs_usage_bytes", Kind: METRIC_KIND_GAUGE, Unit: METRIC_UNIT_BYTES, Display: "FS Usage"},
+		},
+	}
+
+	// the default catalog is always valid
+	_ = catalog.index()
+	return catalog
+}
+
+// LoadCatalog reads a catalog file (YAML or JSON) on top of the default catalog.
+// Metrics of the file replace the default metrics with the same key and any other
+// metric is added, labels which are set in the file replace the default label names
+func LoadCatalog(path string) (*MetricCatalog, error) {
+	catalog := DefaultCatalog()
+	if path == "" {
+		return catalog, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metrics catalog: %w", err)
+	}
+
+	var file MetricCatalog
+	if err := yaml.UnmarshalStrict(b, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse metrics catalog %s: %w", path, err)
+	}
+
+	catalog.merge(&file)
+	if err := catalog.index(); err != nil {
+		return nil, fmt.Errorf("invalid metrics catalog %s: %w", path, err)
+	}
+	return catalog, nil
+}
+
+func (c *MetricCatalog) merge(other *MetricCatalog) {
+	if other.Labels.Pod != "" {
+		c.Labels.Pod = other.Labels.Pod
+	}
+	if other.Labels.Container != "" {
+		c.Labels.Container = other.Labels.Container
+	}
+	if other.Labels.Namespace != "" {
+		c.Labels.Namespace = other.Labels.Namespace
+	}
+	if other.Labels.Image != "" {
+		c.Labels.Image = other.Labels.Image
+	}
+	c.IgnoredLabels = append(c.IgnoredLabels, other.IgnoredLabels...)
+
+	for _, metric := range other.Metrics {
+		replaced := false
+		for i, existing := range c.Metrics {
+			if existing.Key == metric.Key {
+				c.Metrics[i] = metric
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			c.Metrics = append(c.Metrics, metric)
+		}
+	}
+}
+
+// index validates the catalog and builds the lookups used while parsing
+func (c *MetricCatalog) index() error {
+	c.bySeries = make(map[string][]*MetricDefinition)
+	c.byKey = make(map[string]*MetricDefinition)
+	for _, metric := range c.Metrics {
+		if metric.Key == "" || metric.Series == "" {
+			return fmt.Errorf("every metric must have a key and a series")
+		}
+		if _, ok := c.byKey[metric.Key]; ok {
+			return fmt.Errorf("duplicate metric key %q", metric.Key)
+		}
+		if metric.Kind != METRIC_KIND_COUNTER && metric.Kind != METRIC_KIND_GAUGE {
+			return fmt.Errorf("metric %q has unknown kind %q, expected %s or %s", metric.Key, metric.Kind, METRIC_KIND_COUNTER, METRIC_KIND_GAUGE)
+		}
+		if metric.Level == "" {
+			metric.Level = METRIC_LEVEL_CONTAINER
+		}
+		if metric.Level != METRIC_LEVEL_CONTAINER && metric.Level != METRIC_LEVEL_POD {
+			return fmt.Errorf("metric %q has unknown level %q, expected %s or %s", metric.Key, metric.Level, METRIC_LEVEL_CONTAINER, METRIC_LEVEL_POD)
+		}
+		if metric.Display == "" {
+			metric.Display = metric.Key
+		}
+
+		c.byKey[metric.Key] = metric
+		c.bySeries[metric.Series] = append(c.bySeries[metric.Series], metric)
+	}
+	return nil
+}
+
+// Metric returns the definition of the metric with the given key, or nil
+func (c *MetricCatalog) Metric(key string) *MetricDefinition {
+	return c.byKey[key]
+}
+
+// Series returns the names of all the cAdvisor series the catalog reads
+func (c *MetricCatalog) Series() map[string]bool {
+	series := make(map[string]bool, len(c.bySeries))
+	for name := range c.bySeries {
+		series[name] = true
+	}
+	return series
+}
+
+// definitions returns the metrics read out of a series
+func (c *MetricCatalog) definitions(series string) []*MetricDefinition {
+	return c.bySeries[series]
+}
@@ -1,44 +1,114 @@
 package k8s
 
 import (
+	"fmt"
 	"time"
 )
 
+// MemoryBasis selects which memory metric is compared against the memory limit
+type MemoryBasis string
+
+const (
+	// working set is what the kubelet uses for evictions and what the OOM killer sees
+	MEMORY_BASIS_WORKING_SET MemoryBasis = "working-set"
+	// usage includes reclaimable page cache
+	MEMORY_BASIS_USAGE MemoryBasis = "usage"
+	MEMORY_BASIS_RSS   MemoryBasis = "rss"
+)
+
+func ParseMemoryBasis(basis string) (MemoryBasis, error) {
+	switch MemoryBasis(basis) {
+	case MEMORY_BASIS_WORKING_SET, MEMORY_BASIS_USAGE, MEMORY_BASIS_RSS:
+		return MemoryBasis(basis), nil
+	default:
+		return "", fmt.Errorf("unknown memory basis %q, expected one of: %s, %s, %s",
+			basis, MEMORY_BASIS_WORKING_SET, MEMORY_BASIS_USAGE, MEMORY_BASIS_RSS)
+	}
+}
+
 type Container struct {
-	Id                         string
-	Name                       string
-	Image                      string
-	PodName                    string
-	Namespace                  string
-	cpuUsage                   float64
-	lastCpuUsageSecondsTotal   float64
-	lastCpuUsageSecondsTotalTs time.Time
-	memoryUsageBytes           float64
-	cpuRequest                 float64
-	cpuLimits                  float64
-	memoryRequestBytes         float64
-	memoryLimitBytes           float64
+	Id        string
+	Cluster   string
+	Name      string
+	Image     string
+	PodName   string
+	Namespace string
+	NodeName  string
+	Workload  string
+	Pod       *Pod
+	// recent usage of the container, nil when no history is kept
+	History            *History
+	metrics            metricSet
+	lastUpdateTs       time.Time
+	cpuRequest         float64
+	cpuLimits          float64
+	memoryRequestBytes float64
+	memoryLimitBytes   float64
 }
 
 type Stats struct {
-	Namespace          string
-	PodName            string
-	ContainerName      string
-	CpuUsageMilli      float64
-	MemoryBytes        float64
-	LastUpdateTs       time.Time
-	MemoryLimitBytes   float64
+	Cluster       string
+	Namespace     string
+	PodName       string
+	ContainerName string
+	NodeName      string
+	Workload      string
+	// id of the pod the container belongs to, unique across clusters
+	PodId          string
+	CpuUsageMilli  float64
+	CpuUserMilli   float64
+	CpuSystemMilli float64
+	// share of the CFS periods in which the container was throttled during the last refresh interval
+	CpuThrottledPercent float64
+	// total time the container was throttled during the last refresh interval
+	CpuThrottledSeconds float64
+	// memory according to the selected memory basis
+	MemoryBytes           float64
+	MemoryUsageBytes      float64
+	MemoryWorkingSetBytes float64
+	MemoryRssBytes        float64
+	MemoryCacheBytes      float64
+	LastUpdateTs          time.Time
+	MemoryRequestBytes    float64
+	MemoryLimitBytes      float64
+	// cpu request and limit in millicores
+	CpuRequest         float64
 	CpuLimit           float64
 	MemoryUsagePercent float64
 	CpuUsagePercent    float64
+	// usage as a share of the request, unlike the share of the limit it may exceed 100%
+	CpuRequestPercent    float64
+	MemoryRequestPercent float64
+	FsReadBytesPerSec    float64
+	FsWriteBytesPerSec   float64
+	FsUsageBytes         float64
+	// network rates of the pod the container belongs to
+	NetworkRxBytesPerSec   float64
+	NetworkTxBytesPerSec   float64
+	NetworkRxPacketsPerSec float64
+	NetworkTxPacketsPerSec float64
+	NetworkRxDroppedPerSec float64
+	NetworkTxDroppedPerSec float64
+	// every catalog metric of the container and its pod keyed by the metric key,
+	// counters are per second rates
+	Metrics map[string]float64
+	// recent cpu usage in millicores and memory according to the memory basis, from the oldest to the latest
+	CpuHistory    []float64
+	MemoryHistory []float64
+}
+
+// NetworkDroppedPerSec returns the received and transmitted packets dropped per second
+func (s *Stats) NetworkDroppedPerSec() float64 {
+	return s.NetworkRxDroppedPerSec + s.NetworkTxDroppedPerSec
 }
 
-func (c *Container) GetStats() *Stats {
-	if c.cpuUsage == 0 && c.memoryUsageBytes == 0 {
+func (c *Container) GetStats(memoryBasis MemoryBasis) *Stats {
+	cpuUsage := c.metrics.get(METRIC_CPU_USAGE)
+	if cpuUsage == 0 && c.metrics.get(METRIC_MEM_USAGE) == 0 && c.metrics.get(METRIC_MEM_WORKING_SET) == 0 {
 		return nil
 	}
 
-	cpuUsageInMillis := c.cpuUsage * 1000
+	cpuUsageInMillis := cpuUsage * 1000
 	var cpuUsagePercent float64
 	if c.cpuLimits > 0 {
 		cpuUsagePercent = cpuUsageInMillis / c.cpuLimits * 100
@@ -48,49 +118,109 @@ func (c *Container) GetStats() *Stats {
 		cpuUsagePercent = 100
 	}
 
+	memoryBytes := c.getMemoryBytes(memoryBasis)
 	var memoryUsagePercent float64
 	if c.memoryLimitBytes > 0 {
-		memoryUsagePercent = c.memoryUsageBytes / c.memoryLimitBytes * 100
+		memoryUsagePercent = memoryBytes / c.memoryLimitBytes * 100
 	}
 
 	if memoryUsagePercent > 100 {
 		memoryUsagePercent = 100
 	}
 
-	return &Stats{
-		Namespace:          c.Namespace,
-		PodName:            c.PodName,
-		ContainerName:      c.Name,
-		CpuUsageMilli:      cpuUsageInMillis,
-		MemoryBytes:        c.memoryUsageBytes,
-		LastUpdateTs:       c.lastCpuUsageSecondsTotalTs,
-		CpuLimit:           c.cpuLimits,
-		MemoryLimitBytes:   c.memoryLimitBytes,
-		CpuUsagePercent:    cpuUsagePercent,
-		MemoryUsagePercent: memoryUsagePercent,
+	stats := &Stats{
+		Cluster:               c.Cluster,
+		Namespace:             c.Namespace,
+		NodeName:              c.NodeName,
+		Workload:              c.Workload,
+		PodName:               c.PodName,
+		ContainerName:         c.Name,
+		CpuUsageMilli:         cpuUsageInMillis,
+		CpuUserMilli:          c.metrics.get(METRIC_CPU_USER) * 1000,
+		CpuSystemMilli:        c.metrics.get(METRIC_CPU_SYSTEM) * 1000,
+		MemoryBytes:           memoryBytes,
+		MemoryUsageBytes:      c.metrics.get(METRIC_MEM_USAGE),
+		MemoryWorkingSetBytes: c.metrics.get(METRIC_MEM_WORKING_SET),
+		MemoryRssBytes:        c.metrics.get(METRIC_MEM_RSS),
+		MemoryCacheBytes:      c.metrics.get(METRIC_MEM_CACHE),
+		LastUpdateTs:          c.lastUpdateTs,
+		CpuRequest:            c.cpuRequest,
+		CpuLimit:              c.cpuLimits,
+		MemoryRequestBytes:    c.memoryRequestBytes,
+		MemoryLimitBytes:      c.memoryLimitBytes,
+		CpuUsagePercent:       cpuUsagePercent,
+		MemoryUsagePercent:    memoryUsagePercent,
+		FsReadBytesPerSec:     c.metrics.get(METRIC_FS_READS),
+		FsWriteBytesPerSec:    c.metrics.get(METRIC_FS_WRITES),
+		FsUsageBytes:          c.metrics.get(METRIC_FS_USAGE),
+		Metrics:               make(map[string]float64, len(c.metrics)),
+	}
+	stats.fillRequestPercents()
+	c.fillThrottling(stats)
+	c.metrics.fill(stats.Metrics)
+	if c.History != nil {
+		c.History.fillStats(stats, memoryBasis)
+	}
+	if c.Pod != nil {
+		stats.PodId = c.Pod.Id
+		c.Pod.fillStats(stats)
+	}
+	return stats
+}
+
+func (s *Stats) fillRequestPercents() {
+	if s.CpuRequest > 0 {
+		s.CpuRequestPercent = s.CpuUsageMilli / s.CpuRequest * 100
+	}
+	if s.MemoryRequestBytes > 0 {
+		s.MemoryRequestPercent = s.MemoryBytes / s.MemoryRequestBytes * 100
 	}
 }
 
-func (c *Container) UpdateCpu(cpu *Cpu, fetchTime time.Time) {
-	if c.lastCpuUsageSecondsTotal == cpu.CpuUsageSecondsTotal {
-		return
+func (c *Container) getMemoryBytes(memoryBasis MemoryBasis) float64 {
+	switch memoryBasis {
+	case MEMORY_BASIS_USAGE:
+		return c.metrics.get(METRIC_MEM_USAGE)
+	case MEMORY_BASIS_RSS:
+		return c.metrics.get(METRIC_MEM_RSS)
+	default:
+		return c.metrics.get(METRIC_MEM_WORKING_SET)
 	}
+}
 
-	timeDiff := fetchTime.Sub(c.lastCpuUsageSecondsTotalTs)
-	if !c.lastCpuUsageSecondsTotalTs.IsZero() && timeDiff > 0 {
-		increaseInCpu := cpu.CpuUsageSecondsTotal - c.lastCpuUsageSecondsTotal
-		c.cpuUsage = (increaseInCpu) / timeDiff.Seconds()
+func (c *Container) fillThrottling(stats *Stats) {
+	increaseInPeriods := c.metrics.delta(METRIC_CPU_CFS_PERIODS)
+	if increaseInPeriods <= 0 {
+		// no cpu limit, or the container did not run at all during the interval
+		return
 	}
 
-	c.lastCpuUsageSecondsTotal = cpu.CpuUsageSecondsTotal
-	c.lastCpuUsageSecondsTotalTs = fetchTime
+	stats.CpuThrottledPercent = c.metrics.delta(METRIC_CPU_CFS_THROTTLED_PERIODS) / increaseInPeriods * 100
+	stats.CpuThrottledSeconds = c.metrics.delta(METRIC_CPU_CFS_THROTTLED_SECONDS)
 }
 
-func (c *Container) UpdateMemory(memory *Memory, fetchTime time.Time) {
-	c.memoryUsageBytes = memory.MemoryUsageBytes
+func (c *Container) Update(sample *Sample, fetchTime time.Time) {
+	if c.metrics == nil {
+		c.metrics = make(metricSet)
+	}
+	c.metrics.update(sample.Values, fetchTime)
+	c.lastUpdateTs = fetchTime
+
+	// the cpu usage of counters is only known from their second sample on, an idle container is sampled as 0
+	if c.History != nil && c.metrics.isKnown(METRIC_CPU_USAGE) {
+		c.History.Add(HistorySample{
+			Ts:                    fetchTime,
+			CpuUsageMilli:         c.metrics.get(METRIC_CPU_USAGE) * 1000,
+			MemoryUsageBytes:      c.metrics.get(METRIC_MEM_USAGE),
+			MemoryWorkingSetBytes: c.metrics.get(METRIC_MEM_WORKING_SET),
+			MemoryRssBytes:        c.metrics.get(METRIC_MEM_RSS),
+		})
+	}
 }
 
 func (c *Container) UpdateResources(resources *ContainerResources) {
+	c.NodeName = resources.NodeName
+	c.Workload = resources.Workload
 	c.cpuRequest = resources.Request.Cpu
 	c.cpuLimits = resources.Limit.Cpu
 	c.memoryRequestBytes = resources.Request.Memory
@@ -0,0 +1,71 @@
+package k8s
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrEmptyFamily      = errors.New("metric family has no samples")
+	ErrInvalidLabels    = errors.New("invalid label set")
+	ErrInvalidValue     = errors.New("invalid sample value")
+	ErrInvalidTimestamp = errors.New("invalid sample timestamp")
+)
+
+// FamilyError is reported when a whole metric family is skipped
+type FamilyError struct {
+	Family string
+	Err    error
+}
+
+func (e *FamilyError) Error() string {
+	return fmt.Sprintf("metric family %s: %v", e.Family, e.Err)
+}
+
+func (e *FamilyError) Unwrap() error {
+	return e.Err
+}
+
+// SampleError is reported when a single sample of a metric family is skipped
+type SampleError struct {
+	Family string
+	// position of the sample within its family
+	Index int
+	Err   error
+}
+
+func (e *SampleError) Error() string {
+	return fmt.Sprintf("metric family %s, sample %d: %v", e.Family, e.Index, e.Err)
+}
+
+func (e *SampleError) Unwrap() error {
+	return e.Err
+}
+
+// ParseWarnings collects the problems found while parsing which
+// did not prevent the rest of the metrics from being parsed
+type ParseWarnings struct {
+	// FamilyError and SampleError values
+	Errors []error
+	// number of samples carrying each label murre does not know about
+	UnknownLabels map[string]int
+}
+
+func newParseWarnings() *ParseWarnings {
+	return &ParseWarnings{
+		UnknownLabels: make(map[string]int),
+	}
+}
+
+// Count returns the total number of skipped families, skipped samples and unknown labels
+func (w *ParseWarnings) Count() int {
+	count := len(w.Errors)
+	for _, n := range w.UnknownLabels {
+		count += n
+	}
+	return count
+}
+
+func (w *ParseWarnings) addError(err error) {
+	w.Errors = append(w.Errors, err)
+}
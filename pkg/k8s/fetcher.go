@@ -3,148 +3,523 @@ package k8s
 import (
 	"context"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/client-go/kubernetes"
 )
 
 const (
-	CADVISOR_PATH_TEMPLATE = "/api/v1/nodes/%s/proxy/metrics/cadvisor"
+	// paths of the kubelet API
+	CADVISOR_PATH = "/metrics/cadvisor"
+	SUMMARY_PATH  = "/stats/summary"
+)
+
+// MetricsSource selects the kubelet endpoint the metrics are read from
+type MetricsSource string
+
+const (
+	METRICS_SOURCE_CADVISOR MetricsSource = "cadvisor"
+	// the Summary API is available on clusters which restrict the cAdvisor endpoint,
+	// but it reports fewer metrics (no cpu breakdown, throttling, cache memory or packet counts)
+	METRICS_SOURCE_SUMMARY MetricsSource = "summary"
+	// metrics-server needs no access to the kubelet proxy, but it reports only cpu and
+	// working set memory, averaged over its window instead of the latest values
+	METRICS_SOURCE_METRICS_SERVER MetricsSource = "metrics-server"
 )
 
+func ParseMetricsSource(source string) (MetricsSource, error) {
+	switch MetricsSource(source) {
+	case METRICS_SOURCE_CADVISOR, METRICS_SOURCE_SUMMARY, METRICS_SOURCE_METRICS_SERVER:
+		return MetricsSource(source), nil
+	default:
+		return "", fmt.Errorf("unknown metrics source %q, expected one of: %s, %s, %s",
+			source, METRICS_SOURCE_CADVISOR, METRICS_SOURCE_SUMMARY, METRICS_SOURCE_METRICS_SERVER)
+	}
+}
+
+// ScrapesNodes reports whether the source is read from every node separately
+func (s MetricsSource) ScrapesNodes() bool {
+	return s != METRICS_SOURCE_METRICS_SERVER
+}
+
 type Resources struct {
 	Cpu    float64
 	Memory float64
 }
 
 type ContainerResources struct {
+	// name of the kubeconfig context of the cluster
+	Cluster   string
 	PodName   string
 	Name      string
 	Namespace string
 	Image     string
-	Request   Resources
-	Limit     Resources
+	NodeName  string
+	// kind and name of the workload managing the pod, e.g. Deployment/api
+	Workload string
+	Request  Resources
+	Limit    Resources
 }
 type NodeMetrics struct {
-	NodeName  string
-	Cpu       []*Cpu
-	Memory    []*Memory
+	Cluster  string
+	NodeName string
+	*Metrics
 	Timestamp time.Time
 }
 
+// NodeHealth tracks the outcome of the recent scrapes of a single node
+type NodeHealth struct {
+	Cluster             string
+	NodeName            string
+	LastError           error
+	LastErrorTs         time.Time
+	LastSuccessTs       time.Time
+	ConsecutiveFailures int
+	// problems found while parsing the last successful scrape
+	ParseWarnings *ParseWarnings
+}
+
+// IsStale reports whether the last scrape of the node failed,
+// meaning its containers show values from an earlier tick
+func (h *NodeHealth) IsStale() bool {
+	return h.ConsecutiveFailures > 0
+}
+
+// NodeChurn describes the nodes that joined or left the cluster
+// between two refreshes of the node list
+type NodeChurn struct {
+	Added   []string
+	Removed []string
+	Ts      time.Time
+}
+
+// FetchResult holds the metrics of every node that was scraped successfully
+// along with the health of all nodes, including the ones that failed
+type FetchResult struct {
+	Metrics    []*NodeMetrics
+	NodeHealth []*NodeHealth
+	// set only when the node list changed since the previous fetch
+	NodeChurn *NodeChurn
+	// source the metrics were read from
+	Source MetricsSource
+	// set when the metrics could not be read from this source and were read from Source instead
+	FallbackFrom MetricsSource
+	// errors which did not fail the fetch as a whole, e.g. of a single cluster out of several
+	Errors []error
+	// nodes which were not scraped because they host no pods matching the pod filter
+	SkippedNodes []*SkippedNode
+}
+
+// SkippedNode is a node which was not scraped, so the usage of its containers is unknown
+type SkippedNode struct {
+	Cluster  string
+	NodeName string
+}
+
+// FailedNodes returns the number of nodes whose last scrape failed
+func (r *FetchResult) FailedNodes() int {
+	failed := 0
+	for _, h := range r.NodeHealth {
+		if h.IsStale() {
+			failed++
+		}
+	}
+	return failed
+}
+
+// ParseWarnings returns the number of parse warnings over all nodes
+func (r *FetchResult) ParseWarnings() int {
+	warnings := 0
+	for _, h := range r.NodeHealth {
+		if h.ParseWarnings != nil {
+			warnings += h.ParseWarnings.Count()
+		}
+	}
+	return warnings
+}
+
+type FetcherOptions struct {
+	// number of nodes scraped in parallel
+	Concurrency int
+	// timeout for scraping a single node
+	NodeTimeout time.Duration
+	// metrics to read out of cAdvisor, the default catalog when nil.
+	// Only used when the metrics are read from cAdvisor
+	Catalog *MetricCatalog
+	// read the metrics from metrics-server when access to the kubelet proxy is forbidden on all nodes
+	FallbackToMetricsServer bool
+	// how the kubelets are reached, through the node proxy of the API server when nil
+	Kubelet KubeletClient
+	// limit the pods and nodes which are fetched
+	Selectors Selectors
+	// scrape only the nodes which host pods matching the filter
+	PodFilter PodFilter
+	// resolve the Deployments and CronJobs managing the pods
+	ResolveWorkloads bool
+}
+
+func (o FetcherOptions) specCacheOptions() SpecCacheOptions {
+	return SpecCacheOptions{
+		Selectors:        o.Selectors,
+		ResolveWorkloads: o.ResolveWorkloads,
+		Namespace:        o.PodFilter.Namespace,
+	}
+}
+
+// PodFilter matches pods by their exact namespace, name and container names,
+// empty fields match every pod
+type PodFilter struct {
+	Namespace string
+	Pod       string
+	Container string
+}
+
+func (f PodFilter) IsEmpty() bool {
+	return f.Namespace == "" && f.Pod == "" && f.Container == ""
+}
+
+func (f PodFilter) Matches(pod *v1.Pod) bool {
+	if f.Namespace != "" && f.Namespace != pod.Namespace {
+		return false
+	}
+	if f.Pod != "" && f.Pod != pod.Name {
+		return false
+	}
+	if f.Container == "" {
+		return true
+	}
+	for _, container := range pod.Spec.Containers {
+		if container.Name == f.Container {
+			return true
+		}
+	}
+	return false
+}
+
+// scrapeFunc reads the metrics of a single node
+type scrapeFunc func(ctx context.Context, node *v1.Node) (*Metrics, error)
+
+// nodeFetcher scrapes all nodes of the cluster in parallel and tracks the health of every node,
+// the fetchers of the different kubelet endpoints only differ in the way a single node is scraped
+type nodeFetcher struct {
+	clientset *kubernetes.Clientset
+	specCache *SpecCache
+	options   FetcherOptions
+	source    MetricsSource
+	scrape    scrapeFunc
+	nodes     []string
+	health    map[string]*NodeHealth
+	// nil unless FallbackToMetricsServer is set, used for good once the kubelet proxy is forbidden
+	fallback      *MetricsServerFetcher
+	usingFallback bool
+}
+
+func newNodeFetcher(clientset *kubernetes.Clientset, options FetcherOptions, source MetricsSource, scrape scrapeFunc) *nodeFetcher {
+	if options.Concurrency < 1 {
+		options.Concurrency = 1
+	}
+	if options.Kubelet == nil {
+		options.Kubelet = NewProxyKubeletClient(clientset)
+	}
+
+	f := &nodeFetcher{
+		clientset: clientset,
+		specCache: NewSpecCache(clientset, options.specCacheOptions()),
+		options:   options,
+		source:    source,
+		scrape:    scrape,
+		health:    make(map[string]*NodeHealth),
+	}
+	if options.FallbackToMetricsServer {
+		f.fallback = newMetricsServerFetcher(clientset, f.specCache, options)
+	}
+	return f
+}
+
+// Fetcher reads the metrics of every node from the cAdvisor endpoint of its kubelet
 type Fetcher struct {
-	clientset     *kubernetes.Clientset
+	*nodeFetcher
 	metricsParser *Parser
-	nodes         []string
 }
 
-func NewFetcher(clientset *kubernetes.Clientset) *Fetcher {
-	return &Fetcher{
-		clientset:     clientset,
-		metricsParser: NewParser(),
+func NewFetcher(clientset *kubernetes.Clientset, options FetcherOptions) *Fetcher {
+	if options.Catalog == nil {
+		options.Catalog = DefaultCatalog()
+	}
+
+	f := &Fetcher{
+		metricsParser: NewParser(options.Catalog),
 	}
+	f.nodeFetcher = newNodeFetcher(clientset, options, METRICS_SOURCE_CADVISOR, f.scrapeCadvisor)
+	return f
 }
 
-func (f *Fetcher) GetMetrics() ([]*NodeMetrics, error) {
-	nodes, err := f.getNodes()
+func (f *Fetcher) scrapeCadvisor(ctx context.Context, node *v1.Node) (*Metrics, error) {
+	body, err := f.options.Kubelet.Get(ctx, node, CADVISOR_PATH)
 	if err != nil {
 		return nil, err
 	}
+	defer body.Close()
 
-	metrics := make([]*NodeMetrics, 0)
-	for _, node := range nodes {
-		nodeMetric, err := f.fetchMetricsFromNode(node)
-		if err != nil {
-			return nil, err
-		}
-		metrics = append(metrics, nodeMetric)
-	}
+	return f.metricsParser.Parse(body)
+}
 
-	return metrics, nil
+// Start fills the spec cache and keeps it up to date until stopCh is closed
+func (f *nodeFetcher) Start(stopCh <-chan struct{}) error {
+	return f.specCache.Start(stopCh)
 }
 
-func (f *Fetcher) GetContainers() ([]*ContainerResources, error) {
-	pods, err := f.clientset.CoreV1().Pods("").List(context.Background(), metav1.ListOptions{})
+// GetMetrics scrapes all nodes. A node that fails to be scraped does not fail
+// the whole fetch, it is reported through the NodeHealth of the result instead
+func (f *nodeFetcher) GetMetrics() (*FetchResult, error) {
+	if f.usingFallback {
+		return f.getFallbackMetrics()
+	}
+
+	churn, err := f.refreshNodes()
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := f.nodesToScrape()
 	if err != nil {
 		return nil, err
 	}
-	containers := make([]*ContainerResources, 0)
-	for _, pod := range pods.Items {
-		for _, container := range pod.Spec.Containers {
-			requestCpu := container.Resources.Requests.Cpu()
-			requestMemory := container.Resources.Requests.Memory()
-			limitCpu := container.Resources.Limits.Cpu()
-			limitMemory := container.Resources.Limits.Memory()
-			containerResource := &ContainerResources{
-				PodName:   pod.Name,
-				Name:      container.Name,
-				Namespace: pod.Namespace,
-				Image:     container.Image,
-				Request: Resources{
-					Cpu:    0,
-					Memory: 0,
-				},
-				Limit: Resources{
-					Cpu:    0,
-					Memory: 0,
-				},
-			}
-			if requestCpu != nil {
-				containerResource.Request.Cpu = float64(requestCpu.MilliValue())
-			}
 
-			if requestMemory != nil {
-				containerResource.Request.Memory = float64(requestMemory.Value())
-			}
-			if limitCpu != nil {
-				containerResource.Limit.Cpu = float64(limitCpu.MilliValue())
-			}
-			if limitMemory != nil {
-				containerResource.Limit.Memory = float64(limitMemory.Value())
+	// every worker writes only to the index of the node it scraped,
+	// so the result keeps the order of the node list
+	metrics := make([]*NodeMetrics, len(nodes))
+	errs := make([]error, len(nodes))
+
+	workers := f.options.Concurrency
+	if workers > len(nodes) {
+		workers = len(nodes)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				metrics[i], errs[i] = f.fetchMetricsFromNode(nodes[i])
 			}
+		}()
+	}
+
+	for i := range nodes {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	result := &FetchResult{
+		Metrics:      make([]*NodeMetrics, 0, len(nodes)),
+		NodeHealth:   make([]*NodeHealth, 0, len(nodes)),
+		NodeChurn:    churn,
+		Source:       f.source,
+		SkippedNodes: skippedNodes(f.nodes, nodes),
+	}
+	for i, node := range nodes {
+		health := f.updateHealth(node, metrics[i], errs[i])
+		result.NodeHealth = append(result.NodeHealth, health)
+		if errs[i] == nil {
+			result.Metrics = append(result.Metrics, metrics[i])
+		}
+	}
+
+	if f.fallback != nil && isProxyForbidden(result.NodeHealth) {
+		f.usingFallback = true
+		return f.getFallbackMetrics()
+	}
+
+	result.Errors = append(result.Errors, f.specCache.WatchErrors()...)
+	return result, nil
+}
+
+func skippedNodes(all []string, scraped []string) []*SkippedNode {
+	isScraped := make(map[string]bool, len(scraped))
+	for _, node := range scraped {
+		isScraped[node] = true
+	}
+	skipped := make([]*SkippedNode, 0, len(all)-len(scraped))
+	for _, node := range all {
+		if !isScraped[node] {
+			skipped = append(skipped, &SkippedNode{NodeName: node})
+		}
+	}
+	return skipped
+}
 
-			containers = append(containers, containerResource)
+func (f *nodeFetcher) getFallbackMetrics() (*FetchResult, error) {
+	result, err := f.fallback.GetMetrics()
+	if err != nil {
+		return nil, err
+	}
+	result.FallbackFrom = f.source
+	return result, nil
+}
+
+// isProxyForbidden reports whether the last scrape of every node was rejected as forbidden,
+// which means the user lacks access to the kubelets rather than the nodes being down
+func isProxyForbidden(health []*NodeHealth) bool {
+	if len(health) == 0 {
+		return false
+	}
+	for _, h := range health {
+		if !h.IsStale() || !apierrors.IsForbidden(h.LastError) {
+			return false
 		}
 	}
-	return containers, nil
+	return true
+}
+
+func (f *nodeFetcher) GetContainers() ([]*ContainerResources, error) {
+	return f.specCache.Containers()
+}
+
+func (f *nodeFetcher) GetNodes() ([]*NodeResources, error) {
+	return f.specCache.NodeResources()
 }
 
-func (f *Fetcher) getNodes() ([]string, error) {
-	if len(f.nodes) > 0 {
+// nodesToScrape returns the nodes which host pods matching the pod filter or the pod selectors,
+// or all nodes when there is nothing to filter by. It is based on the spec cache,
+// so the nodes follow the pods as they are scheduled and deleted
+func (f *nodeFetcher) nodesToScrape() ([]string, error) {
+	if f.options.PodFilter.IsEmpty() && !f.options.Selectors.selectsPods() {
 		return f.nodes, nil
 	}
 
-	nodes, err := f.clientset.CoreV1().Nodes().List(context.Background(), metav1.ListOptions{})
+	pods, err := f.specCache.Pods()
 	if err != nil {
 		return nil, err
 	}
+	hosts := make(map[string]bool)
+	for _, pod := range pods {
+		if pod.Spec.NodeName != "" && f.options.PodFilter.Matches(pod) {
+			hosts[pod.Spec.NodeName] = true
+		}
+	}
 
-	f.nodes = make([]string, len(nodes.Items))
-	for i, node := range nodes.Items {
-		f.nodes[i] = node.Name
+	nodes := make([]string, 0, len(hosts))
+	for _, node := range f.nodes {
+		if hosts[node] {
+			nodes = append(nodes, node)
+		}
 	}
-	return f.nodes, nil
+	return nodes, nil
 }
 
-func (f *Fetcher) fetchMetricsFromNode(node string) (*NodeMetrics, error) {
-	fetchTime := time.Now()
-	path := fmt.Sprintf(CADVISOR_PATH_TEMPLATE, node)
-	b, err := f.clientset.RESTClient().Get().AbsPath(path).Do(context.Background()).Raw()
+// refreshNodes reads the node list from the spec cache, which is kept up to date
+// by a watch, and returns the nodes that joined or left since the previous fetch
+func (f *nodeFetcher) refreshNodes() (*NodeChurn, error) {
+	nodes, err := f.getNodes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	isFirstListing := f.nodes == nil
+	churn := f.diffNodes(nodes)
+	f.nodes = nodes
+
+	for _, node := range churn.Removed {
+		delete(f.health, node)
+	}
+
+	if isFirstListing || (len(churn.Added) == 0 && len(churn.Removed) == 0) {
+		return nil, nil
+	}
+	return churn, nil
+}
+
+func (f *nodeFetcher) diffNodes(nodes []string) *NodeChurn {
+	churn := &NodeChurn{Ts: time.Now()}
+
+	previous := make(map[string]bool, len(f.nodes))
+	for _, node := range f.nodes {
+		previous[node] = true
+	}
+
+	for _, node := range nodes {
+		if previous[node] {
+			delete(previous, node)
+			continue
+		}
+		churn.Added = append(churn.Added, node)
+	}
+
+	for node := range previous {
+		churn.Removed = append(churn.Removed, node)
+	}
+	sort.Strings(churn.Removed)
+
+	return churn
+}
+
+func (f *nodeFetcher) getNodes() ([]string, error) {
+	nodes, err := f.specCache.Nodes()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(nodes))
+	for i, node := range nodes {
+		names[i] = node.Name
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (f *nodeFetcher) fetchMetricsFromNode(node string) (*NodeMetrics, error) {
+	ctx := context.Background()
+	if f.options.NodeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.options.NodeTimeout)
+		defer cancel()
+	}
+
+	spec, err := f.specCache.Node(node)
 	if err != nil {
 		return nil, err
 	}
 
-	cpu, memory, err := f.metricsParser.Parse(b)
+	fetchTime := time.Now()
+	metrics, err := f.scrape(ctx, spec)
 	if err != nil {
 		return nil, err
 	}
+	f.specCache.FilterSamples(metrics)
 
 	return &NodeMetrics{
 		NodeName:  node,
-		Cpu:       cpu,
-		Memory:    memory,
+		Metrics:   metrics,
 		Timestamp: fetchTime,
 	}, nil
 }
+
+// updateHealth records the outcome of a node scrape and returns a snapshot
+// of the node health which is safe to hand out to callers
+func (f *nodeFetcher) updateHealth(node string, metrics *NodeMetrics, err error) *NodeHealth {
+	health, ok := f.health[node]
+	if !ok {
+		health = &NodeHealth{NodeName: node}
+		f.health[node] = health
+	}
+
+	if err != nil {
+		health.LastError = fmt.Errorf("failed to fetch metrics from node %s: %w", node, err)
+		health.LastErrorTs = time.Now()
+		health.ConsecutiveFailures++
+	} else {
+		health.LastSuccessTs = time.Now()
+		health.ConsecutiveFailures = 0
+		health.ParseWarnings = metrics.Warnings
+	}
+
+	snapshot := *health
+	return &snapshot
+}
@@ -0,0 +1,179 @@
+package k8s
+
+import (
+	"fmt"
+)
+
+// GroupBy selects what the stats of the containers are summed up to
+type GroupBy string
+
+const (
+	GROUP_BY_CONTAINER GroupBy = "container"
+	GROUP_BY_POD       GroupBy = "pod"
+	// pods are grouped by the Deployment, StatefulSet, DaemonSet or CronJob managing them
+	GROUP_BY_WORKLOAD  GroupBy = "workload"
+	GROUP_BY_NAMESPACE GroupBy = "namespace"
+	GROUP_BY_NODE      GroupBy = "node"
+)
+
+func ParseGroupBy(groupBy string) (GroupBy, error) {
+	switch GroupBy(groupBy) {
+	case GROUP_BY_CONTAINER, GROUP_BY_POD, GROUP_BY_WORKLOAD, GROUP_BY_NAMESPACE, GROUP_BY_NODE:
+		return GroupBy(groupBy), nil
+	default:
+		return "", fmt.Errorf("unknown group by %q, expected one of: %s, %s, %s, %s, %s",
+			groupBy, GROUP_BY_CONTAINER, GROUP_BY_POD, GROUP_BY_WORKLOAD, GROUP_BY_NAMESPACE, GROUP_BY_NODE)
+	}
+}
+
+// group holds the stats of a group while its containers are summed up
+type group struct {
+	stats *Stats
+	// pods whose pod level metrics were already added, they are shared by all of the pod containers
+	pods map[string]bool
+	// a single container without a limit makes the whole group unlimited
+	cpuUnlimited    bool
+	memoryUnlimited bool
+}
+
+// GroupStats sums up the usage, requests and limits of the containers of every group.
+// Pod level metrics (e.g. network) are added once per pod and the throttling of a group
+// is the throttling of its most throttled container. Containers are returned as they are
+func GroupStats(stats []*Stats, groupBy GroupBy, catalog *MetricCatalog) []*Stats {
+	if groupBy == GROUP_BY_CONTAINER {
+		return stats
+	}
+
+	groups := make(map[string]*group)
+	order := make([]string, 0)
+	for _, s := range stats {
+		key := groupKey(s, groupBy)
+		g, ok := groups[key]
+		if !ok {
+			g = newGroup(s, groupBy)
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.add(s, catalog)
+	}
+
+	grouped := make([]*Stats, 0, len(groups))
+	for _, key := range order {
+		grouped = append(grouped, groups[key].finish())
+	}
+	return grouped
+}
+
+func groupKey(s *Stats, groupBy GroupBy) string {
+	switch groupBy {
+	case GROUP_BY_POD:
+		return s.Cluster + "/" + s.Namespace + "/" + s.PodName
+	case GROUP_BY_WORKLOAD:
+		return s.Cluster + "/" + s.Namespace + "/" + s.Workload
+	case GROUP_BY_NAMESPACE:
+		return s.Cluster + "/" + s.Namespace
+	default:
+		return s.Cluster + "/" + s.NodeName
+	}
+}
+
+func newGroup(s *Stats, groupBy GroupBy) *group {
+	stats := &Stats{
+		Cluster: s.Cluster,
+		Metrics: make(map[string]float64),
+	}
+	switch groupBy {
+	case GROUP_BY_POD:
+		stats.Namespace = s.Namespace
+		stats.PodName = s.PodName
+		stats.PodId = s.PodId
+		stats.NodeName = s.NodeName
+		stats.Workload = s.Workload
+	case GROUP_BY_WORKLOAD:
+		stats.Namespace = s.Namespace
+		stats.Workload = s.Workload
+	case GROUP_BY_NAMESPACE:
+		stats.Namespace = s.Namespace
+	case GROUP_BY_NODE:
+		stats.NodeName = s.NodeName
+	}
+
+	return &group{
+		stats: stats,
+		pods:  make(map[string]bool),
+	}
+}
+
+func (g *group) add(s *Stats, catalog *MetricCatalog) {
+	total := g.stats
+	total.CpuUsageMilli += s.CpuUsageMilli
+	total.CpuUserMilli += s.CpuUserMilli
+	total.CpuSystemMilli += s.CpuSystemMilli
+	total.CpuThrottledSeconds += s.CpuThrottledSeconds
+	if s.CpuThrottledPercent > total.CpuThrottledPercent {
+		total.CpuThrottledPercent = s.CpuThrottledPercent
+	}
+	total.MemoryBytes += s.MemoryBytes
+	total.MemoryUsageBytes += s.MemoryUsageBytes
+	total.MemoryWorkingSetBytes += s.MemoryWorkingSetBytes
+	total.MemoryRssBytes += s.MemoryRssBytes
+	total.MemoryCacheBytes += s.MemoryCacheBytes
+	total.CpuRequest += s.CpuRequest
+	total.MemoryRequestBytes += s.MemoryRequestBytes
+	total.CpuLimit += s.CpuLimit
+	total.MemoryLimitBytes += s.MemoryLimitBytes
+	g.cpuUnlimited = g.cpuUnlimited || s.CpuLimit == 0
+	g.memoryUnlimited = g.memoryUnlimited || s.MemoryLimitBytes == 0
+	total.FsReadBytesPerSec += s.FsReadBytesPerSec
+	total.FsWriteBytesPerSec += s.FsWriteBytesPerSec
+	total.FsUsageBytes += s.FsUsageBytes
+	total.CpuHistory = addHistory(total.CpuHistory, s.CpuHistory)
+	total.MemoryHistory = addHistory(total.MemoryHistory, s.MemoryHistory)
+	if s.LastUpdateTs.After(total.LastUpdateTs) {
+		total.LastUpdateTs = s.LastUpdateTs
+	}
+
+	isNewPod := !g.pods[s.PodId]
+	g.pods[s.PodId] = true
+	if isNewPod {
+		total.NetworkRxBytesPerSec += s.NetworkRxBytesPerSec
+		total.NetworkTxBytesPerSec += s.NetworkTxBytesPerSec
+		total.NetworkRxPacketsPerSec += s.NetworkRxPacketsPerSec
+		total.NetworkTxPacketsPerSec += s.NetworkTxPacketsPerSec
+		total.NetworkRxDroppedPerSec += s.NetworkRxDroppedPerSec
+		total.NetworkTxDroppedPerSec += s.NetworkTxDroppedPerSec
+	}
+
+	for key, value := range s.Metrics {
+		metric := catalog.Metric(key)
+		if metric != nil && metric.Level == METRIC_LEVEL_POD && !isNewPod {
+			continue
+		}
+		total.Metrics[key] += value
+	}
+}
+
+func (g *group) finish() *Stats {
+	total := g.stats
+	if g.cpuUnlimited {
+		total.CpuLimit = 0
+	}
+	if g.memoryUnlimited {
+		total.MemoryLimitBytes = 0
+	}
+
+	if total.CpuLimit > 0 {
+		total.CpuUsagePercent = total.CpuUsageMilli / total.CpuLimit * 100
+	}
+	if total.CpuUsagePercent > 100 {
+		total.CpuUsagePercent = 100
+	}
+	if total.MemoryLimitBytes > 0 {
+		total.MemoryUsagePercent = total.MemoryBytes / total.MemoryLimitBytes * 100
+	}
+	if total.MemoryUsagePercent > 100 {
+		total.MemoryUsagePercent = 100
+	}
+	total.fillRequestPercents()
+	return total
+}
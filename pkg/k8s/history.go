@@ -0,0 +1,83 @@
+package k8s
+
+import (
+	"time"
+)
+
+// HistorySample is the usage of a container at the time it was fetched
+type HistorySample struct {
+	Ts time.Time
+	// cpu usage in millicores
+	CpuUsageMilli         float64
+	MemoryUsageBytes      float64
+	MemoryWorkingSetBytes float64
+	MemoryRssBytes        float64
+}
+
+// History is a ring buffer of the recent samples of a container,
+// once full every new sample replaces the oldest one
+type History struct {
+	samples []HistorySample
+	// index of the oldest sample
+	start int
+	size  int
+}
+
+func NewHistory(capacity int) *History {
+	return &History{
+		samples: make([]HistorySample, capacity),
+	}
+}
+
+func (h *History) Add(sample HistorySample) {
+	if len(h.samples) == 0 {
+		return
+	}
+	if h.size < len(h.samples) {
+		h.samples[(h.start+h.size)%len(h.samples)] = sample
+		h.size++
+		return
+	}
+	h.samples[h.start] = sample
+	h.start = (h.start + 1) % len(h.samples)
+}
+
+// Samples returns the samples from the oldest to the latest
+func (h *History) Samples() []HistorySample {
+	samples := make([]HistorySample, h.size)
+	for i := range samples {
+		samples[i] = h.samples[(h.start+i)%len(h.samples)]
+	}
+	return samples
+}
+
+// fillStats copies the cpu usage and the memory according to the memory basis into the stats
+func (h *History) fillStats(stats *Stats, memoryBasis MemoryBasis) {
+	samples := h.Samples()
+	stats.CpuHistory = make([]float64, len(samples))
+	stats.MemoryHistory = make([]float64, len(samples))
+	for i, sample := range samples {
+		stats.CpuHistory[i] = sample.CpuUsageMilli
+		switch memoryBasis {
+		case MEMORY_BASIS_USAGE:
+			stats.MemoryHistory[i] = sample.MemoryUsageBytes
+		case MEMORY_BASIS_RSS:
+			stats.MemoryHistory[i] = sample.MemoryRssBytes
+		default:
+			stats.MemoryHistory[i] = sample.MemoryWorkingSetBytes
+		}
+	}
+}
+
+// addHistory sums up two histories sample by sample, aligned on their latest sample
+func addHistory(total, history []float64) []float64 {
+	if len(history) > len(total) {
+		total, history = history, total
+	}
+	sum := append([]float64{}, total...)
+	offset := len(sum) - len(history)
+	for i, value := range history {
+		sum[offset+i] += value
+	}
+	return sum
+}
@@ -0,0 +1,136 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	NODE_PROXY_PATH_TEMPLATE = "/api/v1/nodes/%s/proxy%s"
+	DEFAULT_KUBELET_PORT     = 10250
+	// size of the response body included in the error of a failed kubelet request
+	KUBELET_ERROR_BODY_SIZE = 512
+)
+
+// KubeletClient reads a path of the kubelet API of a node
+type KubeletClient interface {
+	Get(ctx context.Context, node *v1.Node, path string) (io.ReadCloser, error)
+}
+
+// ProxyKubeletClient reaches the kubelets through the node proxy of the API server
+type ProxyKubeletClient struct {
+	clientset *kubernetes.Clientset
+}
+
+func NewProxyKubeletClient(clientset *kubernetes.Clientset) *ProxyKubeletClient {
+	return &ProxyKubeletClient{
+		clientset: clientset,
+	}
+}
+
+func (c *ProxyKubeletClient) Get(ctx context.Context, node *v1.Node, path string) (io.ReadCloser, error) {
+	return c.clientset.RESTClient().Get().AbsPath(fmt.Sprintf(NODE_PROXY_PATH_TEMPLATE, node.Name, path)).Stream(ctx)
+}
+
+type DirectKubeletOptions struct {
+	// file holding a bearer token which replaces the credentials of the kubeconfig
+	BearerTokenFile string
+	// skip verifying the kubelet serving certificates, which are often self signed
+	InsecureSkipTLSVerify bool
+}
+
+// DirectKubeletClient connects to the kubelets directly, so scraping does not
+// load the API server and keeps working while the API server is struggling
+type DirectKubeletClient struct {
+	httpClient *http.Client
+}
+
+// NewDirectKubeletClient creates a client which authenticates to the kubelets the same way
+// it authenticates to the API server of config, unless options say otherwise
+func NewDirectKubeletClient(config *rest.Config, options DirectKubeletOptions) (*DirectKubeletClient, error) {
+	config = rest.CopyConfig(config)
+	// the kubelets serve a certificate of their own
+	config.TLSClientConfig.ServerName = ""
+
+	if options.BearerTokenFile != "" {
+		config.BearerTokenFile = options.BearerTokenFile
+		config.BearerToken = ""
+		config.Username = ""
+		config.Password = ""
+		config.AuthProvider = nil
+		config.ExecProvider = nil
+		config.TLSClientConfig.CertFile = ""
+		config.TLSClientConfig.CertData = nil
+		config.TLSClientConfig.KeyFile = ""
+		config.TLSClientConfig.KeyData = nil
+	}
+
+	if options.InsecureSkipTLSVerify {
+		config.TLSClientConfig.Insecure = true
+		config.TLSClientConfig.CAFile = ""
+		config.TLSClientConfig.CAData = nil
+	}
+
+	httpClient, err := rest.HTTPClientFor(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubelet client: %w", err)
+	}
+
+	return &DirectKubeletClient{
+		httpClient: httpClient,
+	}, nil
+}
+
+func (c *DirectKubeletClient) Get(ctx context.Context, node *v1.Node, path string) (io.ReadCloser, error) {
+	host, err := kubeletHost(node)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+host+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, KUBELET_ERROR_BODY_SIZE))
+		// report the status the same way the API server does, so that e.g. forbidden requests can be told apart
+		return nil, apierrors.NewGenericServerResponse(resp.StatusCode, http.MethodGet, schema.GroupResource{Resource: "nodes"}, node.Name, string(body), 0, false)
+	}
+
+	return resp.Body, nil
+}
+
+// kubeletHost returns the address and port the kubelet of node listens on,
+// preferring the internal address of the node
+func kubeletHost(node *v1.Node) (string, error) {
+	port := int(node.Status.DaemonEndpoints.KubeletEndpoint.Port)
+	if port == 0 {
+		port = DEFAULT_KUBELET_PORT
+	}
+
+	for _, addressType := range []v1.NodeAddressType{v1.NodeInternalIP, v1.NodeExternalIP, v1.NodeHostName} {
+		for _, address := range node.Status.Addresses {
+			if address.Type == addressType && address.Address != "" {
+				return net.JoinHostPort(address.Address, strconv.Itoa(port)), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("node %s has no address to reach its kubelet", node.Name)
+}
@@ -0,0 +1,96 @@
+package k8s
+
+import (
+	"time"
+)
+
+// metricValue tracks a single catalog metric of a container or a pod
+type metricValue struct {
+	kind MetricKind
+	// per second rate for counters, latest value for gauges
+	value float64
+	// increase of a counter between its last two samples
+	delta  float64
+	last   float64
+	lastTs time.Time
+	// the value is known, counters have a rate from their second sample on
+	known bool
+}
+
+// metricSet holds the catalog metrics of a container or a pod keyed by the metric key
+type metricSet map[string]*metricValue
+
+// update rates counters against their previous sample and keeps the latest value of gauges.
+// Samples without a timestamp are considered to be collected at fetchTime
+func (s metricSet) update(values map[string]*SampleValue, fetchTime time.Time) {
+	for key, sample := range values {
+		ts := sample.Ts
+		if ts.IsZero() {
+			ts = fetchTime
+		}
+
+		metric, ok := s[key]
+		if !ok {
+			metric = &metricValue{}
+			s[key] = metric
+		}
+		metric.kind = sample.Kind
+
+		if sample.Kind == METRIC_KIND_GAUGE {
+			metric.value = sample.Value
+			metric.lastTs = ts
+			metric.known = true
+			continue
+		}
+
+		// cAdvisor caches its values, a counter which was not collected again
+		// since the previous fetch keeps its last rate
+		if !ts.After(metric.lastTs) {
+			continue
+		}
+
+		if !metric.lastTs.IsZero() {
+			metric.delta = sample.Value - metric.last
+			if metric.delta < 0 {
+				// the counter was reset, e.g. after a restart
+				metric.delta = 0
+			}
+			metric.value = metric.delta / ts.Sub(metric.lastTs).Seconds()
+			metric.known = true
+		}
+		metric.last = sample.Value
+		metric.lastTs = ts
+	}
+}
+
+// get returns the rate of a counter or the value of a gauge, 0 for unknown metrics
+func (s metricSet) get(key string) float64 {
+	if metric, ok := s[key]; ok {
+		return metric.value
+	}
+	return 0
+}
+
+// isKnown returns whether the rate of a counter or the value of a gauge was sampled,
+// which tells a counter that did not increase apart from one sampled once
+func (s metricSet) isKnown(key string) bool {
+	if metric, ok := s[key]; ok {
+		return metric.known
+	}
+	return false
+}
+
+// delta returns the increase of a counter between its last two samples
+func (s metricSet) delta(key string) float64 {
+	if metric, ok := s[key]; ok {
+		return metric.delta
+	}
+	return 0
+}
+
+// fill copies the value of every metric into values
+func (s metricSet) fill(values map[string]float64) {
+	for key, metric := range s {
+		values[key] = metric.value
+	}
+}
@@ -0,0 +1,131 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	METRICS_SERVER_PODS_PATH = "/apis/metrics.k8s.io/v1beta1/pods"
+)
+
+// The types below are the subset of the metrics.k8s.io PodMetrics API murre reads,
+// declared here to avoid depending on the metrics module
+type podMetricsList struct {
+	Items []podMetrics `json:"items"`
+}
+
+type podMetrics struct {
+	Metadata   podReference       `json:"metadata"`
+	Timestamp  time.Time          `json:"timestamp"`
+	Containers []containerMetrics `json:"containers"`
+}
+
+type containerMetrics struct {
+	Name  string          `json:"name"`
+	Usage v1.ResourceList `json:"usage"`
+}
+
+// MetricsServerFetcher reads the metrics of all pods from metrics-server with a single request.
+// It needs no access to the kubelet proxy, but only reports cpu and working set memory,
+// averaged over the metrics-server window (usually 15 to 60 seconds)
+type MetricsServerFetcher struct {
+	clientset *kubernetes.Clientset
+	specCache *SpecCache
+	options   FetcherOptions
+}
+
+func NewMetricsServerFetcher(clientset *kubernetes.Clientset, options FetcherOptions) *MetricsServerFetcher {
+	return newMetricsServerFetcher(clientset, NewSpecCache(clientset, options.specCacheOptions()), options)
+}
+
+func newMetricsServerFetcher(clientset *kubernetes.Clientset, specCache *SpecCache, options FetcherOptions) *MetricsServerFetcher {
+	return &MetricsServerFetcher{
+		clientset: clientset,
+		specCache: specCache,
+		options:   options,
+	}
+}
+
+// Start fills the spec cache and keeps it up to date until stopCh is closed
+func (f *MetricsServerFetcher) Start(stopCh <-chan struct{}) error {
+	return f.specCache.Start(stopCh)
+}
+
+// GetMetrics lists the metrics of all pods. metrics-server is not tied to a node,
+// so the result holds a single entry without a node name and no node health
+func (f *MetricsServerFetcher) GetMetrics() (*FetchResult, error) {
+	ctx := context.Background()
+	if f.options.NodeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.options.NodeTimeout)
+		defer cancel()
+	}
+
+	fetchTime := time.Now()
+	body, err := f.clientset.RESTClient().Get().AbsPath(METRICS_SERVER_PODS_PATH).Stream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch metrics from metrics-server: %w", err)
+	}
+	defer body.Close()
+
+	var list podMetricsList
+	if err := json.NewDecoder(body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode metrics-server pod metrics: %w", err)
+	}
+
+	metrics := list.metrics()
+	f.specCache.FilterSamples(metrics)
+
+	return &FetchResult{
+		Metrics: []*NodeMetrics{{
+			Metrics:   metrics,
+			Timestamp: fetchTime,
+		}},
+		Source: METRICS_SOURCE_METRICS_SERVER,
+		Errors: f.specCache.WatchErrors(),
+	}, nil
+}
+
+func (f *MetricsServerFetcher) GetContainers() ([]*ContainerResources, error) {
+	return f.specCache.Containers()
+}
+
+func (f *MetricsServerFetcher) GetNodes() ([]*NodeResources, error) {
+	return f.specCache.NodeResources()
+}
+
+// metrics converts the pod metrics into samples keyed by the built-in catalog metrics
+func (l *podMetricsList) metrics() *Metrics {
+	metrics := &Metrics{
+		Containers: make([]*Sample, 0),
+		Pods:       make([]*Sample, 0),
+		Warnings:   newParseWarnings(),
+	}
+
+	for _, pod := range l.Items {
+		for _, container := range pod.Containers {
+			sample := &Sample{
+				Name:      container.Name,
+				PodName:   pod.Metadata.Name,
+				Namespace: pod.Metadata.Namespace,
+				Values:    make(map[string]*SampleValue),
+			}
+			// metrics-server already reports the cpu usage as a rate
+			if cpu, ok := container.Usage[v1.ResourceCPU]; ok {
+				sample.setGauge(METRIC_CPU_USAGE, cpu.AsApproximateFloat64(), pod.Timestamp)
+			}
+			if memory, ok := container.Usage[v1.ResourceMemory]; ok {
+				sample.setGauge(METRIC_MEM_WORKING_SET, memory.AsApproximateFloat64(), pod.Timestamp)
+			}
+			metrics.Containers = append(metrics.Containers, sample)
+		}
+	}
+
+	return metrics
+}
@@ -0,0 +1,90 @@
+package k8s
+
+// NodeResources describes the capacity of a node and what the pods running on it reserved
+type NodeResources struct {
+	// name of the kubeconfig context of the cluster
+	Cluster     string
+	Name        string
+	Capacity    Resources
+	Allocatable Resources
+	// sum of the requests and limits of the containers of the pods running on the node
+	Request Resources
+	Limit   Resources
+	Pods    int
+}
+
+// NodeStats compares the usage and the requests of the containers of a node with what it can allocate
+type NodeStats struct {
+	Cluster  string
+	NodeName string
+	// cpu values are in millicores
+	CpuUsageMilli          float64
+	CpuRequest             float64
+	CpuAllocatable         float64
+	MemoryBytes            float64
+	MemoryRequestBytes     float64
+	MemoryAllocatableBytes float64
+	// usage and requests as a share of the allocatable resources, requests above 100% mean the node is overcommitted
+	CpuUsagePercent      float64
+	CpuRequestPercent    float64
+	MemoryUsagePercent   float64
+	MemoryRequestPercent float64
+	Pods                 int
+	// the container using the most cpu on the node, as namespace/pod/container
+	TopConsumer         string
+	TopConsumerCpuMilli float64
+	// the node was not scraped since it hosts no pods matching the filters, so its usage
+	// is unknown. The requests and pod count of a skipped node are still known
+	Skipped bool
+}
+
+// BuildNodeStats sums up the usage of the containers of every node. The requests and
+// pod count come from the node resources, so they include pods without metrics
+func BuildNodeStats(nodes []*NodeResources, stats []*Stats, skipped []*SkippedNode) []*NodeStats {
+	byNode := make(map[string]*NodeStats, len(nodes))
+	nodeStats := make([]*NodeStats, 0, len(nodes))
+	for _, node := range nodes {
+		s := &NodeStats{
+			Cluster:                node.Cluster,
+			NodeName:               node.Name,
+			CpuRequest:             node.Request.Cpu,
+			CpuAllocatable:         node.Allocatable.Cpu,
+			MemoryRequestBytes:     node.Request.Memory,
+			MemoryAllocatableBytes: node.Allocatable.Memory,
+			Pods:                   node.Pods,
+		}
+		byNode[node.Cluster+"/"+node.Name] = s
+		nodeStats = append(nodeStats, s)
+	}
+
+	for _, node := range skipped {
+		if s, ok := byNode[node.Cluster+"/"+node.NodeName]; ok {
+			s.Skipped = true
+		}
+	}
+
+	for _, container := range stats {
+		node, ok := byNode[container.Cluster+"/"+container.NodeName]
+		if !ok {
+			continue
+		}
+		node.CpuUsageMilli += container.CpuUsageMilli
+		node.MemoryBytes += container.MemoryBytes
+		if container.CpuUsageMilli > node.TopConsumerCpuMilli {
+			node.TopConsumer = container.Namespace + "/" + container.PodName + "/" + container.ContainerName
+			node.TopConsumerCpuMilli = container.CpuUsageMilli
+		}
+	}
+
+	for _, node := range nodeStats {
+		if node.CpuAllocatable > 0 {
+			node.CpuUsagePercent = node.CpuUsageMilli / node.CpuAllocatable * 100
+			node.CpuRequestPercent = node.CpuRequest / node.CpuAllocatable * 100
+		}
+		if node.MemoryAllocatableBytes > 0 {
+			node.MemoryUsagePercent = node.MemoryBytes / node.MemoryAllocatableBytes * 100
+			node.MemoryRequestPercent = node.MemoryRequestBytes / node.MemoryAllocatableBytes * 100
+		}
+	}
+	return nodeStats
+}
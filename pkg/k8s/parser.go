@@ -1,148 +1,163 @@
 package k8s
 
 import (
-	"bytes"
-
-	io_prometheus_client "github.com/prometheus/client_model/go"
-	"github.com/prometheus/common/expfmt"
+	"fmt"
+	"io"
+	"time"
 )
 
-const (
-	CONTAINER_CPU_METRICS = "container_cpu_user_seconds_total"
-	CONTAINER_MEM_METRICS = "container_memory_usage_bytes"
-)
+// SampleValue is the value of a single catalog metric
+type SampleValue struct {
+	Value float64
+	Kind  MetricKind
+	// time the value was collected, zero when the source does not report it
+	Ts time.Time
+}
 
-const (
-	METRIC_POD_LABEL        = "pod"
-	METRIC_CONTAINER_LABEL  = "container"
-	METRIC_NAME_LABEL       = "name"
-	METRICS_NAMESPACE_LABEL = "namespace"
-	METRICS_ID_LABEL        = "id"
-	METRICS_IMAGE_LABEL     = "image"
-	SORT_BY_CPU             = 0
-	SORT_BY_MEM             = 1
-	SORT_BY_POD             = 2
-	SORT_BY_NAMESPACE       = 3
-)
+// Sample holds the values of the catalog metrics of a single container,
+// or of a single pod for pod level metrics, keyed by the metric key
+type Sample struct {
+	// container name, empty for pod samples
+	Name      string
+	Image     string
+	PodName   string
+	Namespace string
+	Values    map[string]*SampleValue
+}
+
+// Metrics holds everything parsed out of the output of a single node
+type Metrics struct {
+	Containers []*Sample
+	Pods       []*Sample
+	Warnings   *ParseWarnings
+}
 
-type Cpu struct {
-	Name                 string
-	Image                string
-	PodName              string
-	Namespace            string
-	CpuUsageSecondsTotal float64
+// labelPair is a label which is needed to match samples against the catalog
+type labelPair struct {
+	name  string
+	value string
 }
 
-type Memory struct {
-	Name             string
-	Image            string
-	PodName          string
-	Namespace        string
-	MemoryUsageBytes float64
+// sampleLabels holds the labels murre reads from every sample
+type sampleLabels struct {
+	Container string
+	Image     string
+	PodName   string
+	Namespace string
+	match     []labelPair
 }
 
 type Parser struct {
+	catalog *MetricCatalog
 }
 
-func NewParser() *Parser {
-	return &Parser{}
+func NewParser(catalog *MetricCatalog) *Parser {
+	return &Parser{
+		catalog: catalog,
+	}
 }
 
-func (p *Parser) Parse(b []byte) ([]*Cpu, []*Memory, error) {
-	reader := bytes.NewReader(b)
+// parseState holds the metrics of a single Parse call while they are being built
+type parseState struct {
+	warnings   *ParseWarnings
+	containers map[string]*Sample
+	pods       map[string]*Sample
+}
 
-	var parser expfmt.TextParser
-	mf, err := parser.TextToMetricFamilies(reader)
-	if err != nil {
-		panic(err.Error())
+// Parse reads the cAdvisor output of a single node as it streams in, only the samples of the
+// series in the catalog are decoded. An error is returned only if the output can not be read at all,
+// problems with single families or samples are skipped and reported through the Warnings of the result
+func (p *Parser) Parse(reader io.Reader) (*Metrics, error) {
+	state := &parseState{
+		warnings:   newParseWarnings(),
+		containers: make(map[string]*Sample),
+		pods:       make(map[string]*Sample),
 	}
-	cpuMetrics := make([]*Cpu, 0)
-	memoryMetrics := make([]*Memory, 0)
-
-	for k, v := range mf {
-		if k == CONTAINER_CPU_METRICS {
-			metrics := v.GetMetric()
-			if len(metrics) == 0 {
-				panic(0)
-			}
-			cpuMetrics = append(cpuMetrics, p.parseCpuMetrics(metrics)...)
-		}
-		if k == CONTAINER_MEM_METRICS {
-			metrics := v.GetMetric()
-			if len(metrics) == 0 {
-				panic(0)
+
+	scanner := newSampleScanner(reader, p.catalog, state.warnings)
+	for scanner.Scan() {
+		labels := scanner.Labels()
+		for _, definition := range p.catalog.definitions(scanner.Family()) {
+			if !labels.matches(definition.Match) {
+				continue
 			}
-			memoryMetrics = append(memoryMetrics, p.parseMemoryMetrics(metrics)...)
+			state.addSample(definition, labels, scanner.Value(), scanner.Ts())
 		}
 	}
-	return cpuMetrics, memoryMetrics, nil
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cAdvisor output: %w", err)
+	}
+
+	return state.metrics(), nil
 }
 
-func (p *Parser) parseCpuMetrics(metrics []*io_prometheus_client.Metric) []*Cpu {
-	cpuMetrics := make([]*Cpu, 0, len(metrics))
-	for _, metric := range metrics {
-		labels := metric.GetLabel()
-		if len(labels) == 0 {
-			panic(0)
+// addSample adds a value to the sample of its container or pod, values of the same
+// metric which differ only in labels murre ignores (e.g. device or interface) are summed up
+func (s *parseState) addSample(definition *MetricDefinition, labels *sampleLabels, value float64, ts time.Time) {
+	var sample *Sample
+	switch definition.Level {
+	case METRIC_LEVEL_POD:
+		if labels.PodName == "" || labels.Namespace == "" {
+			// node level interfaces
+			return
 		}
-		cpuMetric := &Cpu{}
-		for _, label := range labels {
-			switch label.GetName() {
-			case METRIC_POD_LABEL:
-				cpuMetric.PodName = label.GetValue()
-			case METRIC_CONTAINER_LABEL:
-				cpuMetric.Name = label.GetValue()
-			case METRIC_NAME_LABEL:
-				continue
-			case METRICS_NAMESPACE_LABEL:
-				cpuMetric.Namespace = label.GetValue()
-			case METRICS_IMAGE_LABEL:
-				cpuMetric.Image = label.GetValue()
-			case METRICS_ID_LABEL:
-				continue
-			default:
-				panic(label.GetName())
-			}
+		sample = getOrCreateSample(s.pods, labels.Namespace+"/"+labels.PodName, labels, "")
+	default:
+		if labels.Container == "" || labels.PodName == "" || labels.Namespace == "" {
+			// pod and node level cgroups
+			return
 		}
+		sample = getOrCreateSample(s.containers, labels.Namespace+"/"+labels.PodName+"/"+labels.Container, labels, labels.Container)
+	}
 
-		cpuMetric.CpuUsageSecondsTotal = metric.GetCounter().GetValue()
-		if cpuMetric.Name == "" || cpuMetric.PodName == "" || cpuMetric.Namespace == "" {
-			//todo - dont know why this happens
-			continue
-		}
-		cpuMetrics = append(cpuMetrics, cpuMetric)
+	existing, ok := sample.Values[definition.Key]
+	if !ok {
+		sample.Values[definition.Key] = &SampleValue{Value: value, Kind: definition.Kind, Ts: ts}
+		return
+	}
+	existing.Value += value
+	if ts.After(existing.Ts) {
+		existing.Ts = ts
 	}
-	return cpuMetrics
 }
 
-func (p *Parser) parseMemoryMetrics(metrics []*io_prometheus_client.Metric) []*Memory {
-	memoryMetrics := make([]*Memory, 0, len(metrics))
-	for _, metric := range metrics {
-		labels := metric.GetLabel()
-		if len(labels) == 0 {
-			panic(0)
+func getOrCreateSample(samples map[string]*Sample, id string, labels *sampleLabels, name string) *Sample {
+	sample, ok := samples[id]
+	if !ok {
+		sample = &Sample{
+			Name:      name,
+			Image:     labels.Image,
+			PodName:   labels.PodName,
+			Namespace: labels.Namespace,
+			Values:    make(map[string]*SampleValue),
 		}
-		memoryMetric := &Memory{}
-		for _, label := range labels {
-			switch label.GetName() {
-			case METRIC_POD_LABEL:
-				memoryMetric.PodName = label.GetValue()
-			case METRIC_CONTAINER_LABEL:
-				memoryMetric.Name = label.GetValue()
-			case METRIC_NAME_LABEL:
-				continue
-			case METRICS_NAMESPACE_LABEL:
-				memoryMetric.Namespace = label.GetValue()
-			case METRICS_IMAGE_LABEL:
-				memoryMetric.Image = label.GetValue()
-			case METRICS_ID_LABEL:
-				continue
-			default:
-				panic(label.GetName())
-			}
+		samples[id] = sample
+	}
+	return sample
+}
+
+func (s *parseState) metrics() *Metrics {
+	containers := make([]*Sample, 0, len(s.containers))
+	for _, sample := range s.containers {
+		containers = append(containers, sample)
+	}
+	pods := make([]*Sample, 0, len(s.pods))
+	for _, sample := range s.pods {
+		pods = append(pods, sample)
+	}
+	return &Metrics{
+		Containers: containers,
+		Pods:       pods,
+		Warnings:   s.warnings,
+	}
+}
+
+// matches reports whether none of the labels of the sample contradicts the match of a metric
+func (l *sampleLabels) matches(match map[string]string) bool {
+	for _, label := range l.match {
+		if expected, ok := match[label.name]; ok && expected != label.value {
+			return false
 		}
-		memoryMetric.MemoryUsageBytes = metric.GetGauge().GetValue()
-		memoryMetrics = append(memoryMetrics, memoryMetric)
 	}
-	return memoryMetrics
+	return true
 }
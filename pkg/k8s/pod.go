@@ -0,0 +1,38 @@
+package k8s
+
+import (
+	"time"
+)
+
+// Pod holds the metrics which are reported for the pod sandbox
+// rather than for each container, and which are shared by all of the pod containers
+type Pod struct {
+	Id           string
+	Name         string
+	Namespace    string
+	metrics      metricSet
+	lastUpdateTs time.Time
+}
+
+func (p *Pod) Update(sample *Sample, fetchTime time.Time) {
+	if p.metrics == nil {
+		p.metrics = make(metricSet)
+	}
+	p.metrics.update(sample.Values, fetchTime)
+	p.lastUpdateTs = fetchTime
+}
+
+// LastUpdateTs returns the time the pod metrics were last fetched
+func (p *Pod) LastUpdateTs() time.Time {
+	return p.lastUpdateTs
+}
+
+func (p *Pod) fillStats(stats *Stats) {
+	stats.NetworkRxBytesPerSec = p.metrics.get(METRIC_NET_RX_BYTES)
+	stats.NetworkTxBytesPerSec = p.metrics.get(METRIC_NET_TX_BYTES)
+	stats.NetworkRxPacketsPerSec = p.metrics.get(METRIC_NET_RX_PACKETS)
+	stats.NetworkTxPacketsPerSec = p.metrics.get(METRIC_NET_TX_PACKETS)
+	stats.NetworkRxDroppedPerSec = p.metrics.get(METRIC_NET_RX_DROPPED)
+	stats.NetworkTxDroppedPerSec = p.metrics.get(METRIC_NET_TX_DROPPED)
+	p.metrics.fill(stats.Metrics)
+}
@@ -0,0 +1,26 @@
+package k8s
+
+import (
+	"time"
+)
+
+// Status describes the outcome of the most recent refreshes
+type Status struct {
+	// time of the last refresh that produced metrics
+	LastRefreshTs time.Time
+	// source of the last metrics and, if it was used instead, the configured source
+	Source       MetricsSource
+	FallbackFrom MetricsSource
+	// time it took to run the last refresh
+	TickDuration time.Duration
+	Nodes        int
+	NodesScraped int
+	NodesFailed  int
+	// number of parse warnings over all nodes in the last refresh
+	ParseWarnings int
+	// last change of the node list, nil if it did not change since startup
+	LastNodeChurn *NodeChurn
+	// most recent error, either of the whole refresh or of a single node
+	LastError   error
+	LastErrorTs time.Time
+}
@@ -0,0 +1,171 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// The types below are the subset of the kubelet Summary API (stats/v1alpha1) murre reads,
+// declared here to avoid depending on the kubelet module
+type statsSummary struct {
+	Pods []podStats `json:"pods"`
+}
+
+type podStats struct {
+	PodRef     podReference     `json:"podRef"`
+	Containers []containerStats `json:"containers"`
+	Network    *networkStats    `json:"network,omitempty"`
+}
+
+type podReference struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+type containerStats struct {
+	Name   string       `json:"name"`
+	CPU    *cpuStats    `json:"cpu,omitempty"`
+	Memory *memoryStats `json:"memory,omitempty"`
+	Rootfs *fsStats     `json:"rootfs,omitempty"`
+	Logs   *fsStats     `json:"logs,omitempty"`
+}
+
+type cpuStats struct {
+	Time           time.Time `json:"time"`
+	UsageNanoCores *uint64   `json:"usageNanoCores,omitempty"`
+}
+
+type memoryStats struct {
+	Time            time.Time `json:"time"`
+	UsageBytes      *uint64   `json:"usageBytes,omitempty"`
+	WorkingSetBytes *uint64   `json:"workingSetBytes,omitempty"`
+	RSSBytes        *uint64   `json:"rssBytes,omitempty"`
+}
+
+type fsStats struct {
+	Time      time.Time `json:"time"`
+	UsedBytes *uint64   `json:"usedBytes,omitempty"`
+}
+
+type networkStats struct {
+	Time       time.Time        `json:"time"`
+	Interfaces []interfaceStats `json:"interfaces,omitempty"`
+}
+
+type interfaceStats struct {
+	Name    string  `json:"name"`
+	RxBytes *uint64 `json:"rxBytes,omitempty"`
+	TxBytes *uint64 `json:"txBytes,omitempty"`
+}
+
+// SummaryFetcher reads the metrics of every node from the Summary API of its kubelet
+type SummaryFetcher struct {
+	*nodeFetcher
+}
+
+func NewSummaryFetcher(clientset *kubernetes.Clientset, options FetcherOptions) *SummaryFetcher {
+	f := &SummaryFetcher{}
+	f.nodeFetcher = newNodeFetcher(clientset, options, METRICS_SOURCE_SUMMARY, f.scrapeSummary)
+	return f
+}
+
+func (f *SummaryFetcher) scrapeSummary(ctx context.Context, node *v1.Node) (*Metrics, error) {
+	body, err := f.options.Kubelet.Get(ctx, node, SUMMARY_PATH)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var summary statsSummary
+	if err := json.NewDecoder(body).Decode(&summary); err != nil {
+		return nil, fmt.Errorf("failed to decode summary: %w", err)
+	}
+
+	return summary.metrics(), nil
+}
+
+// metrics converts the summary into samples keyed by the built-in catalog metrics,
+// so containers and pods are updated the same way as with cAdvisor
+func (s *statsSummary) metrics() *Metrics {
+	metrics := &Metrics{
+		Containers: make([]*Sample, 0),
+		Pods:       make([]*Sample, 0),
+		Warnings:   newParseWarnings(),
+	}
+
+	for _, pod := range s.Pods {
+		for _, container := range pod.Containers {
+			sample := &Sample{
+				Name:      container.Name,
+				PodName:   pod.PodRef.Name,
+				Namespace: pod.PodRef.Namespace,
+				Values:    make(map[string]*SampleValue),
+			}
+			if container.CPU != nil && container.CPU.UsageNanoCores != nil {
+				// the kubelet already reports the usage as a rate
+				sample.setGauge(METRIC_CPU_USAGE, float64(*container.CPU.UsageNanoCores)/1e9, container.CPU.Time)
+			}
+			if memory := container.Memory; memory != nil {
+				for key, value := range map[string]*uint64{
+					METRIC_MEM_USAGE:       memory.UsageBytes,
+					METRIC_MEM_WORKING_SET: memory.WorkingSetBytes,
+					METRIC_MEM_RSS:         memory.RSSBytes,
+				} {
+					if value != nil {
+						sample.setGauge(key, float64(*value), memory.Time)
+					}
+				}
+			}
+			// the container filesystem usage is split between its writable layer and its logs
+			if container.Rootfs != nil || container.Logs != nil {
+				var usedBytes float64
+				var ts time.Time
+				for _, fs := range []*fsStats{container.Rootfs, container.Logs} {
+					if fs == nil {
+						continue
+					}
+					usedBytes += summaryValue(fs.UsedBytes)
+					if fs.Time.After(ts) {
+						ts = fs.Time
+					}
+				}
+				sample.setGauge(METRIC_FS_USAGE, usedBytes, ts)
+			}
+			metrics.Containers = append(metrics.Containers, sample)
+		}
+
+		if pod.Network != nil {
+			sample := &Sample{
+				PodName:   pod.PodRef.Name,
+				Namespace: pod.PodRef.Namespace,
+				Values:    make(map[string]*SampleValue),
+			}
+			var rxBytes, txBytes float64
+			for _, iface := range pod.Network.Interfaces {
+				rxBytes += summaryValue(iface.RxBytes)
+				txBytes += summaryValue(iface.TxBytes)
+			}
+			sample.Values[METRIC_NET_RX_BYTES] = &SampleValue{Value: rxBytes, Kind: METRIC_KIND_COUNTER, Ts: pod.Network.Time}
+			sample.Values[METRIC_NET_TX_BYTES] = &SampleValue{Value: txBytes, Kind: METRIC_KIND_COUNTER, Ts: pod.Network.Time}
+			metrics.Pods = append(metrics.Pods, sample)
+		}
+	}
+
+	return metrics
+}
+
+func (s *Sample) setGauge(key string, value float64, ts time.Time) {
+	s.Values[key] = &SampleValue{Value: value, Kind: METRIC_KIND_GAUGE, Ts: ts}
+}
+
+func summaryValue(value *uint64) float64 {
+	if value == nil {
+		return 0
+	}
+	return float64(*value)
+}
@@ -0,0 +1,279 @@
+package k8s
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// cAdvisor lines are short, a longer line means the output is broken
+	MAX_LINE_SIZE = 1024 * 1024
+)
+
+// sampleScanner reads the Prometheus text format line by line and decodes only the samples
+// of the wanted families, every other line is skipped as soon as its metric name is read
+type sampleScanner struct {
+	scanner    *bufio.Scanner
+	wanted     map[string]string
+	labelNames LabelNames
+	// labels which are expected but not kept, and labels which are kept only to be matched
+	ignoredLabels map[string]bool
+	matchLabels   map[string]string
+	warnings      *ParseWarnings
+	// number of samples read so far of every wanted family that showed up in the output
+	samples map[string]int
+	family  string
+	labels  sampleLabels
+	value   float64
+	ts      time.Time
+}
+
+func newSampleScanner(reader io.Reader, catalog *MetricCatalog, warnings *ParseWarnings) *sampleScanner {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), MAX_LINE_SIZE)
+
+	// map every family (and label) to itself so that looking it up by the bytes
+	// of a line gives back its name without allocating a new string
+	wanted := make(map[string]string)
+	for family := range catalog.Series() {
+		wanted[family] = family
+	}
+
+	ignoredLabels := make(map[string]bool)
+	for _, label := range catalog.IgnoredLabels {
+		ignoredLabels[label] = true
+	}
+
+	matchLabels := make(map[string]string)
+	for _, metric := range catalog.Metrics {
+		for label := range metric.Match {
+			matchLabels[label] = label
+		}
+	}
+
+	return &sampleScanner{
+		scanner:       scanner,
+		wanted:        wanted,
+		labelNames:    catalog.Labels,
+		ignoredLabels: ignoredLabels,
+		matchLabels:   matchLabels,
+		warnings:      warnings,
+		samples:       make(map[string]int),
+	}
+}
+
+// Scan advances to the next sample of a wanted family, samples which can not be
+// parsed are reported as warnings and skipped. It returns false at the end of the input
+func (s *sampleScanner) Scan() bool {
+	for s.scanner.Scan() {
+		line := s.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		if line[0] == '#' {
+			s.parseComment(line)
+			continue
+		}
+
+		name, rest := splitMetricName(line)
+		family, ok := s.wanted[string(name)]
+		if !ok {
+			continue
+		}
+
+		index := s.samples[family]
+		s.samples[family] = index + 1
+		if err := s.parseSample(rest); err != nil {
+			s.warnings.addError(&SampleError{Family: family, Index: index, Err: err})
+			continue
+		}
+
+		s.family = family
+		return true
+	}
+
+	for family, count := range s.samples {
+		if count == 0 {
+			s.warnings.addError(&FamilyError{Family: family, Err: ErrEmptyFamily})
+		}
+	}
+	return false
+}
+
+func (s *sampleScanner) Err() error {
+	return s.scanner.Err()
+}
+
+func (s *sampleScanner) Family() string {
+	return s.family
+}
+
+// Labels returns the labels of the current sample, they are overwritten by the next call to Scan
+func (s *sampleScanner) Labels() *sampleLabels {
+	return &s.labels
+}
+
+func (s *sampleScanner) Value() float64 {
+	return s.value
+}
+
+// Ts returns the timestamp of the current sample, or the zero time if it has none
+func (s *sampleScanner) Ts() time.Time {
+	return s.ts
+}
+
+// parseComment registers the wanted families announced by a TYPE line,
+// so that families announced without any sample are reported
+func (s *sampleScanner) parseComment(line []byte) {
+	fields := bytes.Fields(line[1:])
+	if len(fields) < 2 || string(fields[0]) != "TYPE" {
+		return
+	}
+
+	if family, ok := s.wanted[string(fields[1])]; ok {
+		if _, seen := s.samples[family]; !seen {
+			s.samples[family] = 0
+		}
+	}
+}
+
+func splitMetricName(line []byte) ([]byte, []byte) {
+	end := bytes.IndexAny(line, "{ \t")
+	if end < 0 {
+		return line, nil
+	}
+	return line[:end], line[end:]
+}
+
+// parseSample parses the optional label set, the value and the optional timestamp following the metric name
+func (s *sampleScanner) parseSample(b []byte) error {
+	s.labels = sampleLabels{match: s.labels.match[:0]}
+	s.ts = time.Time{}
+
+	if len(b) > 0 && b[0] == '{' {
+		rest, err := s.parseLabelSet(b[1:])
+		if err != nil {
+			return err
+		}
+		b = rest
+	}
+
+	fields := bytes.Fields(b)
+	if len(fields) == 0 {
+		return ErrInvalidValue
+	}
+
+	value, err := strconv.ParseFloat(string(fields[0]), 64)
+	if err != nil {
+		return ErrInvalidValue
+	}
+	s.value = value
+
+	if len(fields) > 1 {
+		ms, err := strconv.ParseInt(string(fields[1]), 10, 64)
+		if err != nil {
+			return ErrInvalidTimestamp
+		}
+		s.ts = time.UnixMilli(ms)
+	}
+	return nil
+}
+
+// parseLabelSet parses the labels up to the closing brace and returns what follows it
+func (s *sampleScanner) parseLabelSet(b []byte) ([]byte, error) {
+	i := 0
+	for {
+		i = skipSpaces(b, i)
+		if i >= len(b) {
+			return nil, ErrInvalidLabels
+		}
+		if b[i] == '}' {
+			return b[i+1:], nil
+		}
+
+		nameStart := i
+		for i < len(b) && b[i] != '=' {
+			i++
+		}
+		if i+1 >= len(b) || b[i+1] != '"' {
+			return nil, ErrInvalidLabels
+		}
+		name := bytes.TrimSpace(b[nameStart:i])
+
+		// skip the '=' and the opening quote
+		i += 2
+		valueStart := i
+		isEscaped := false
+		for i < len(b) && b[i] != '"' {
+			if b[i] == '\\' {
+				isEscaped = true
+				i++
+			}
+			i++
+		}
+		if i >= len(b) {
+			return nil, ErrInvalidLabels
+		}
+		s.setLabel(name, b[valueStart:i], isEscaped)
+
+		// skip the closing quote and the separating comma
+		i = skipSpaces(b, i+1)
+		if i < len(b) && b[i] == ',' {
+			i++
+		}
+	}
+}
+
+// setLabel keeps the labels murre reads, unknown labels are counted and otherwise ignored
+func (s *sampleScanner) setLabel(name []byte, value []byte, isEscaped bool) {
+	switch string(name) {
+	case s.labelNames.Pod:
+		s.labels.PodName = labelValue(value, isEscaped)
+	case s.labelNames.Container:
+		s.labels.Container = labelValue(value, isEscaped)
+	case s.labelNames.Namespace:
+		s.labels.Namespace = labelValue(value, isEscaped)
+	case s.labelNames.Image:
+		s.labels.Image = labelValue(value, isEscaped)
+	default:
+		if label, ok := s.matchLabels[string(name)]; ok {
+			s.labels.match = append(s.labels.match, labelPair{name: label, value: labelValue(value, isEscaped)})
+			return
+		}
+		if !s.ignoredLabels[string(name)] {
+			s.warnings.UnknownLabels[string(name)]++
+		}
+	}
+}
+
+func labelValue(value []byte, isEscaped bool) string {
+	if !isEscaped {
+		return string(value)
+	}
+
+	var unescaped strings.Builder
+	unescaped.Grow(len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+			if value[i] == 'n' {
+				unescaped.WriteByte('\n')
+				continue
+			}
+		}
+		unescaped.WriteByte(value[i])
+	}
+	return unescaped.String()
+}
+
+func skipSpaces(b []byte, i int) int {
+	for i < len(b) && (b[i] == ' ' || b[i] == '\t') {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,296 @@
+package k8s
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+)
+
+// cadvisor.txt is a synthetic /metrics/cadvisor output laid out like the output of a busy node:
+// every family cAdvisor exports, pause containers, pod and node cgroups and timestamps.
+// The values are generated, so it covers the parsing of the layout rather than of real values
+const CADVISOR_FIXTURE = "testdata/cadvisor.txt"
+
+type scannedSample struct {
+	family    string
+	container string
+	pod       string
+	namespace string
+	image     string
+	value     float64
+	ts        time.Time
+}
+
+func scanAll(t *testing.T, input string) ([]scannedSample, *ParseWarnings) {
+	t.Helper()
+	warnings := newParseWarnings()
+	scanner := newSampleScanner(strings.NewReader(input), DefaultCatalog(), warnings)
+	samples := make([]scannedSample, 0)
+	for scanner.Scan() {
+		labels := scanner.Labels()
+		samples = append(samples, scannedSample{
+			family:    scanner.Family(),
+			container: labels.Container,
+			pod:       labels.PodName,
+			namespace: labels.Namespace,
+			image:     labels.Image,
+			value:     scanner.Value(),
+			ts:        scanner.Ts(),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("unexpected read error: %v", err)
+	}
+	return samples, warnings
+}
+
+func TestSampleScanner(t *testing.T) {
+	const rss = "container_memory_rss"
+	tests := []struct {
+		name  string
+		input string
+		want  []scannedSample
+		// error every skipped sample is expected to wrap
+		wantErr      error
+		wantSkipped  int
+		wantUnknowns map[string]int
+	}{
+		{
+			name:  "labels value and timestamp",
+			input: `container_memory_rss{container="app",image="repo/app:1.0",namespace="shop",pod="api-1"} 1024 1697600000123`,
+			want: []scannedSample{
+				{family: rss, container: "app", image: "repo/app:1.0", namespace: "shop", pod: "api-1", value: 1024, ts: time.UnixMilli(1697600000123)},
+			},
+		},
+		{
+			name:  "missing timestamp",
+			input: `container_memory_rss{container="app",namespace="shop",pod="api-1"} 1.5e+06`,
+			want: []scannedSample{
+				{family: rss, container: "app", namespace: "shop", pod: "api-1", value: 1.5e+06},
+			},
+		},
+		{
+			name:  "no labels",
+			input: `container_memory_rss 7`,
+			want: []scannedSample{
+				{family: rss, value: 7},
+			},
+		},
+		{
+			name:  "escaped quotes backslashes and newlines",
+			input: `container_memory_rss{container="a\"b",namespace="c\\d",pod="e\nf"} 1`,
+			want: []scannedSample{
+				{family: rss, container: `a"b`, namespace: `c\d`, pod: "e\nf", value: 1},
+			},
+		},
+		{
+			name:  "closing brace inside a label value",
+			input: `container_memory_rss{container="a}b",namespace="shop",pod="{api}"} 2`,
+			want: []scannedSample{
+				{family: rss, container: "a}b", namespace: "shop", pod: "{api}", value: 2},
+			},
+		},
+		{
+			name:  "comma inside a label value",
+			input: `container_memory_rss{container="app",image="repo/app:1,2",namespace="a,b",pod="p"} 3`,
+			want: []scannedSample{
+				{family: rss, container: "app", image: "repo/app:1,2", namespace: "a,b", pod: "p", value: 3},
+			},
+		},
+		{
+			name:  "trailing comma and spaces in the label set",
+			input: `container_memory_rss{ container="app", pod="p", } 4`,
+			want: []scannedSample{
+				{family: rss, container: "app", pod: "p", value: 4},
+			},
+		},
+		{
+			name: "comments empty lines and unwanted families are skipped",
+			input: "# HELP container_memory_rss Size of RSS in bytes.\n" +
+				"# TYPE container_memory_rss gauge\n" +
+				"\n" +
+				`container_last_seen{container="app",pod="p"} 1697600000` + "\n" +
+				`container_memory_rss{container="app",pod="p"} 5`,
+			want: []scannedSample{
+				{family: rss, container: "app", pod: "p", value: 5},
+			},
+		},
+		{
+			name:         "unknown labels are counted",
+			input:        `container_memory_rss{container="app",id="/kubepods",zone="a",pod="p"} 6`,
+			want:         []scannedSample{{family: rss, container: "app", pod: "p", value: 6}},
+			wantUnknowns: map[string]int{"zone": 1},
+		},
+		{
+			name:        "missing value",
+			input:       "container_memory_rss{container=\"app\",pod=\"p\"}\ncontainer_memory_rss{container=\"ok\",pod=\"p\"} 1",
+			want:        []scannedSample{{family: rss, container: "ok", pod: "p", value: 1}},
+			wantErr:     ErrInvalidValue,
+			wantSkipped: 1,
+		},
+		{
+			name:        "invalid value",
+			input:       "container_memory_rss{container=\"app\",pod=\"p\"} 12MiB\ncontainer_memory_rss{container=\"ok\",pod=\"p\"} 1",
+			want:        []scannedSample{{family: rss, container: "ok", pod: "p", value: 1}},
+			wantErr:     ErrInvalidValue,
+			wantSkipped: 1,
+		},
+		{
+			name:        "invalid timestamp",
+			input:       "container_memory_rss{container=\"app\",pod=\"p\"} 1 yesterday\ncontainer_memory_rss{container=\"ok\",pod=\"p\"} 1",
+			want:        []scannedSample{{family: rss, container: "ok", pod: "p", value: 1}},
+			wantErr:     ErrInvalidTimestamp,
+			wantSkipped: 1,
+		},
+		{
+			name: "malformed label sets",
+			input: "container_memory_rss{container=\"app\",pod=\"p\" 1\n" +
+				"container_memory_rss{container=\"app\",pod=\"p} 1\n" +
+				"container_memory_rss{container=app,pod=\"p\"} 1\n" +
+				"container_memory_rss{container\"app\"} 1\n" +
+				"container_memory_rss{container=\"ok\",pod=\"p\"} 1",
+			want:        []scannedSample{{family: rss, container: "ok", pod: "p", value: 1}},
+			wantErr:     ErrInvalidLabels,
+			wantSkipped: 4,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			samples, warnings := scanAll(t, test.input)
+			if !reflect.DeepEqual(samples, test.want) {
+				t.Errorf("got samples %+v, want %+v", samples, test.want)
+			}
+
+			if len(warnings.Errors) != test.wantSkipped {
+				t.Fatalf("got %d skipped samples (%v), want %d", len(warnings.Errors), warnings.Errors, test.wantSkipped)
+			}
+			for _, err := range warnings.Errors {
+				var sampleErr *SampleError
+				if !errors.As(err, &sampleErr) || !errors.Is(err, test.wantErr) {
+					t.Errorf("got error %v, want a sample error wrapping %v", err, test.wantErr)
+				}
+			}
+
+			unknowns := test.wantUnknowns
+			if unknowns == nil {
+				unknowns = map[string]int{}
+			}
+			if !reflect.DeepEqual(warnings.UnknownLabels, unknowns) {
+				t.Errorf("got unknown labels %v, want %v", warnings.UnknownLabels, unknowns)
+			}
+		})
+	}
+}
+
+func TestSampleScannerReportsEmptyFamilies(t *testing.T) {
+	_, warnings := scanAll(t, "# TYPE container_memory_rss gauge\n# TYPE container_memory_cache gauge\ncontainer_memory_cache 1")
+	if len(warnings.Errors) != 1 {
+		t.Fatalf("got %d errors (%v), want 1", len(warnings.Errors), warnings.Errors)
+	}
+	var familyErr *FamilyError
+	if !errors.As(warnings.Errors[0], &familyErr) || familyErr.Family != "container_memory_rss" || !errors.Is(familyErr, ErrEmptyFamily) {
+		t.Errorf("got error %v, want an empty family error for container_memory_rss", warnings.Errors[0])
+	}
+}
+
+// TestParseMatchesExpfmt compares the container memory and cpu usage parsed
+// out of the fixture with what the Prometheus text parser reads from it
+func TestParseMatchesExpfmt(t *testing.T) {
+	fixture := readFixture(t)
+	metrics, err := NewParser(DefaultCatalog()).Parse(bytes.NewReader(fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := metrics.Warnings.Count(); count != 0 {
+		t.Errorf("got %d parse warnings (%v), want none", count, metrics.Warnings.Errors)
+	}
+
+	parsed := make(map[string]*Sample, len(metrics.Containers))
+	for _, sample := range metrics.Containers {
+		parsed[sample.Namespace+"/"+sample.PodName+"/"+sample.Name] = sample
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, series := range map[string]string{
+		METRIC_MEM_WORKING_SET: "container_memory_working_set_bytes",
+		METRIC_CPU_USAGE:       "container_cpu_usage_seconds_total",
+	} {
+		compared := 0
+		for _, metric := range families[series].GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels[METRIC_CONTAINER_LABEL] == "" || labels[METRIC_POD_LABEL] == "" || labels[METRICS_NAMESPACE_LABEL] == "" {
+				continue
+			}
+
+			id := labels[METRICS_NAMESPACE_LABEL] + "/" + labels[METRIC_POD_LABEL] + "/" + labels[METRIC_CONTAINER_LABEL]
+			sample, ok := parsed[id]
+			if !ok || sample.Values[key] == nil {
+				t.Errorf("%s of %s was not parsed", key, id)
+				continue
+			}
+			want := metric.GetGauge().GetValue() + metric.GetCounter().GetValue()
+			if got := sample.Values[key]; got.Value != want || !got.Ts.Equal(time.UnixMilli(metric.GetTimestampMs())) {
+				t.Errorf("%s of %s: got %v at %v, want %v at %v", key, id, got.Value, got.Ts, want, time.UnixMilli(metric.GetTimestampMs()))
+			}
+			compared++
+		}
+		if compared == 0 {
+			t.Errorf("the fixture has no %s samples", series)
+		}
+	}
+}
+
+func readFixture(tb testing.TB) []byte {
+	tb.Helper()
+	fixture, err := os.ReadFile(CADVISOR_FIXTURE)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return fixture
+}
+
+// BenchmarkParse measures the streaming parser, which decodes only the catalog families
+func BenchmarkParse(b *testing.B) {
+	fixture := readFixture(b)
+	parser := NewParser(DefaultCatalog())
+	b.ReportAllocs()
+	b.SetBytes(int64(len(fixture)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := parser.Parse(bytes.NewReader(fixture)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkParseExpfmt measures the previous parsing path, which decoded
+// every family of the output with the Prometheus text parser
+func BenchmarkParseExpfmt(b *testing.B) {
+	fixture := readFixture(b)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(fixture)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var parser expfmt.TextParser
+		if _, err := parser.TextToMetricFamilies(bytes.NewReader(fixture)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -9,20 +9,23 @@ import (
 	"github.com/groundcover-com/murre/pkg/k8s"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
-)
-
-const (
-	FETCH_CONTAINERS_SPEC_RATIO = 5
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
 type DataFetcher interface {
-	GetMetrics() ([]*k8s.NodeMetrics, error)
+	Start(stopCh <-chan struct{}) error
+	GetMetrics() (*k8s.FetchResult, error)
 	GetContainers() ([]*k8s.ContainerResources, error)
+	GetNodes() ([]*k8s.NodeResources, error)
 }
 
 type UI interface {
 	Update(stats []*k8s.Stats)
+	// UpdateNodes receives the filtered containers ungrouped along with the nodes, to drill down into a node
+	UpdateNodes(nodes []*k8s.NodeStats, containers []*k8s.Stats)
+	UpdateStatus(status *k8s.Status)
 }
 
 type ContainerStats struct {
@@ -35,59 +38,240 @@ type ContainerStats struct {
 }
 
 type Murre struct {
-	fetcher      DataFetcher
-	ui           UI
-	config       *config.Config
-	containers   map[string]*k8s.Container
-	fetchCounter int
+	fetcher     DataFetcher
+	ui          UI
+	config      *config.Config
+	catalog     *k8s.MetricCatalog
+	memoryBasis k8s.MemoryBasis
+	groupBy     k8s.GroupBy
+	// number of samples kept in the history of every container
+	historySize int
+	containers  map[string]*k8s.Container
+	pods        map[string]*k8s.Pod
+	nodeHealth  []*k8s.NodeHealth
+	// nodes which were not scraped by the last fetch
+	skippedNodes []*k8s.SkippedNode
+	status       k8s.Status
 	stopCh       chan struct{}
 }
 
-func NewMurre(ui UI, config *config.Config) (*Murre, error) {
-	// use the current context in kubeconfig
-	kubecfg, err := clientcmd.BuildConfigFromFlags("", config.Kubeconfig)
+func NewMurre(ui UI, config *config.Config, catalog *k8s.MetricCatalog) (*Murre, error) {
+	memoryBasis, err := k8s.ParseMemoryBasis(config.MemoryBasis)
 	if err != nil {
 		return nil, err
 	}
 
-	// create the clientset
-	clientset, err := kubernetes.NewForConfig(kubecfg)
+	source, err := k8s.ParseMetricsSource(config.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	groupBy, err := k8s.ParseGroupBy(config.GroupBy)
 	if err != nil {
 		return nil, err
 	}
 
-	fetcher := k8s.NewFetcher(clientset)
-	if fetcher == nil {
+	if err := getSelectors(config).Validate(); err != nil {
 		return nil, err
 	}
 
+	if config.SortBy.Metric != "" && catalog.Metric(config.SortBy.Metric) == nil {
+		return nil, fmt.Errorf("unknown metric %q to sort by", config.SortBy.Metric)
+	}
+
+	contexts, err := resolveContexts(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// a context which can not be used, e.g. a stale one in the kubeconfig, does not stop
+	// murre from monitoring the other contexts, its error is reported in the status bar
+	clusters := make([]*cluster, 0, len(contexts))
+	buildErrors := make([]error, 0)
+	for _, context := range contexts {
+		c, err := newCluster(config, context, source, catalog)
+		if err != nil {
+			if len(contexts) == 1 {
+				return nil, err
+			}
+			buildErrors = append(buildErrors, fmt.Errorf("cluster %s: %w", context, err))
+			continue
+		}
+		clusters = append(clusters, c)
+	}
+	if len(clusters) == 0 {
+		return nil, buildErrors[0]
+	}
+
 	return &Murre{
-		fetcher:      fetcher,
-		ui:           ui,
-		config:       config,
-		containers:   make(map[string]*k8s.Container),
-		stopCh:       make(chan struct{}),
-		fetchCounter: 0,
+		fetcher:     newClusterFetcher(clusters, buildErrors),
+		ui:          ui,
+		config:      config,
+		catalog:     catalog,
+		memoryBasis: memoryBasis,
+		groupBy:     groupBy,
+		historySize: historySize(config),
+		containers:  make(map[string]*k8s.Container),
+		pods:        make(map[string]*k8s.Pod),
+		stopCh:      make(chan struct{}),
 	}, nil
 
 }
 
-func (m *Murre) Run() error {
-	// first tick
-	err := m.tick()
+// historySize returns how many refreshes fit into the history duration
+func historySize(murreConfig *config.Config) int {
+	if murreConfig.History <= 0 || murreConfig.RefreshInterval <= 0 {
+		return 0
+	}
+	return int((murreConfig.History + murreConfig.RefreshInterval - 1) / murreConfig.RefreshInterval)
+}
+
+// newCluster creates the fetcher of the cluster of a kubeconfig context, the current context when empty
+func newCluster(murreConfig *config.Config, context string, source k8s.MetricsSource, catalog *k8s.MetricCatalog) (*cluster, error) {
+	kubecfg, name, err := buildKubeConfig(murreConfig, context)
+	if err != nil {
+		return nil, err
+	}
+
+	// create the clientset
+	clientset, err := kubernetes.NewForConfig(kubecfg)
+	if err != nil {
+		return nil, err
+	}
+
+	options := k8s.FetcherOptions{
+		Concurrency:             murreConfig.Concurrency,
+		NodeTimeout:             murreConfig.NodeTimeout,
+		Catalog:                 catalog,
+		FallbackToMetricsServer: murreConfig.MetricsServerFallback,
+		Selectors:               getSelectors(murreConfig),
+		PodFilter: k8s.PodFilter{
+			Namespace: murreConfig.Filters.Namespace,
+			Pod:       murreConfig.Filters.Pod,
+			Container: murreConfig.Filters.Container,
+		},
+		ResolveWorkloads: murreConfig.ResolveWorkloads || murreConfig.Filters.Workload != "" || murreConfig.GroupBy == string(k8s.GROUP_BY_WORKLOAD),
+	}
+	if murreConfig.KubeletDirect {
+		options.Kubelet, err = k8s.NewDirectKubeletClient(kubecfg, k8s.DirectKubeletOptions{
+			BearerTokenFile:       murreConfig.KubeletTokenFile,
+			InsecureSkipTLSVerify: murreConfig.KubeletInsecureTLS,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var fetcher DataFetcher
+	switch source {
+	case k8s.METRICS_SOURCE_METRICS_SERVER:
+		fetcher = k8s.NewMetricsServerFetcher(clientset, options)
+	case k8s.METRICS_SOURCE_SUMMARY:
+		fetcher = k8s.NewSummaryFetcher(clientset, options)
+	default:
+		fetcher = k8s.NewFetcher(clientset, options)
+	}
+
+	return &cluster{
+		name:    name,
+		fetcher: fetcher,
+	}, nil
+}
+
+func getSelectors(murreConfig *config.Config) k8s.Selectors {
+	return k8s.Selectors{
+		Pod:      murreConfig.Filters.Selector,
+		PodField: murreConfig.Filters.FieldSelector,
+		Node:     murreConfig.Filters.NodeSelector,
+	}
+}
+
+// resolveContexts returns the kubeconfig contexts to monitor, a single empty
+// context stands for the current context
+func resolveContexts(murreConfig *config.Config) ([]string, error) {
+	if !murreConfig.AllContexts {
+		if len(murreConfig.Contexts) == 0 {
+			return []string{""}, nil
+		}
+		return murreConfig.Contexts, nil
+	}
+
+	kubeconfig, err := kubeconfigLoadingRules(murreConfig).Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	contexts := make([]string, 0, len(kubeconfig.Contexts))
+	for context := range kubeconfig.Contexts {
+		contexts = append(contexts, context)
+	}
+	if len(contexts) == 0 {
+		return nil, fmt.Errorf("the kubeconfig has no contexts")
+	}
+	sort.Strings(contexts)
+	return contexts, nil
+}
+
+// kubeconfigLoadingRules reads $KUBECONFIG or ~/.kube/config like kubectl, unless --kubeconfig is set
+func kubeconfigLoadingRules(murreConfig *config.Config) *clientcmd.ClientConfigLoadingRules {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = murreConfig.Kubeconfig
+	return loadingRules
+}
+
+// buildKubeConfig loads the kubeconfig the same way kubectl does: the files listed in
+// $KUBECONFIG are merged, the flags override the current context and when there is
+// no kubeconfig at all, e.g. inside a pod, the in-cluster config is used.
+// It also returns the name of the context that was loaded
+func buildKubeConfig(murreConfig *config.Config, context string) (*rest.Config, string, error) {
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: context,
+		Context: clientcmdapi.Context{
+			Cluster:  murreConfig.Cluster,
+			AuthInfo: murreConfig.User,
+		},
+		AuthInfo: clientcmdapi.AuthInfo{
+			Impersonate: murreConfig.As,
+		},
+	}
+
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(kubeconfigLoadingRules(murreConfig), overrides)
+	kubecfg, err := clientConfig.ClientConfig()
 	if err != nil {
+		return nil, "", fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	name := context
+	if name == "" {
+		// the in-cluster config has no context
+		if kubeconfig, err := clientConfig.RawConfig(); err == nil {
+			name = kubeconfig.CurrentContext
+		}
+	}
+	return kubecfg, name, nil
+}
+
+// Run refreshes the metrics every RefreshInterval until Stop is called.
+// Errors do not stop the loop, they are reported to the UI through the status
+// so that transient failures (e.g. the API server restarting) recover by themselves
+func (m *Murre) Run() error {
+	if err := m.fetcher.Start(m.stopCh); err != nil {
+		m.status.LastError = err
+		m.status.LastErrorTs = time.Now()
+		status := m.status
+		m.ui.UpdateStatus(&status)
 		return err
 	}
 
+	// first tick
+	m.refresh()
+
 	ticker := time.NewTicker(m.config.RefreshInterval)
+	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			err := m.tick()
-			if err != nil {
-				return err
-			}
+			m.refresh()
 		case <-m.stopCh:
 			return nil
 		}
@@ -98,10 +282,29 @@ func (m *Murre) Stop() {
 	close(m.stopCh)
 }
 
+func (m *Murre) refresh() {
+	start := time.Now()
+	lastErrorTs := m.status.LastErrorTs
+	err := m.tick()
+	m.status.TickDuration = time.Since(start)
+	if err != nil {
+		m.status.LastError = err
+		m.status.LastErrorTs = time.Now()
+	} else {
+		m.status.LastRefreshTs = time.Now()
+		// the error is cleared once murre recovered from it, a refresh
+		// which ran into no error and scraped all nodes
+		if m.status.LastErrorTs.Equal(lastErrorTs) && m.status.NodesFailed == 0 {
+			m.status.LastError = nil
+			m.status.LastErrorTs = time.Time{}
+		}
+	}
+
+	status := m.status
+	m.ui.UpdateStatus(&status)
+}
+
 func (m *Murre) tick() error {
-	defer func() {
-		m.fetchCounter++
-	}()
 	err := m.updateContainers()
 	if err != nil {
 		return err
@@ -112,24 +315,29 @@ func (m *Murre) tick() error {
 		return err
 	}
 	stats := m.getStats()
+	nodes, err := m.getNodeStats(stats)
+	if err != nil {
+		return err
+	}
+
 	stats = m.filter(stats)
 	m.sort(stats)
-	m.ui.Update(stats)
+	m.ui.UpdateNodes(nodes, stats)
+
+	grouped := k8s.GroupStats(stats, m.groupBy, m.catalog)
+	m.sort(grouped)
+	m.ui.Update(grouped)
 	return nil
 }
 
 func (m *Murre) updateContainers() error {
-	if m.fetchCounter%FETCH_CONTAINERS_SPEC_RATIO != 0 {
-		return nil
-	}
-
 	containers, err := m.fetcher.GetContainers()
 	if err != nil {
 		return err
 	}
 
 	for _, c := range containers {
-		container := m.getOrCreateContainer(c.Name, c.Image, c.PodName, c.Namespace)
+		container := m.getOrCreateContainer(c.Cluster, c.Name, c.Image, c.PodName, c.Namespace)
 		container.UpdateResources(c)
 	}
 
@@ -139,10 +347,12 @@ func (m *Murre) updateContainers() error {
 func (m *Murre) filter(stats []*k8s.Stats) []*k8s.Stats {
 	filterdStats := make([]*k8s.Stats, 0)
 	for _, s := range stats {
+		isClusterMatch := m.config.Filters.Cluster == "" || m.config.Filters.Cluster == s.Cluster
 		isNamespaceMatch := m.config.Filters.Namespace == "" || m.config.Filters.Namespace == s.Namespace
 		isPodMatch := m.config.Filters.Pod == "" || m.config.Filters.Pod == s.PodName
 		isContainerMatch := m.config.Filters.Container == "" || m.config.Filters.Container == s.ContainerName
-		if isNamespaceMatch && isPodMatch && isContainerMatch {
+		isWorkloadMatch := m.config.Filters.Workload == "" || m.config.Filters.Workload == s.Workload
+		if isClusterMatch && isNamespaceMatch && isPodMatch && isContainerMatch && isWorkloadMatch {
 			filterdStats = append(filterdStats, s)
 		}
 	}
@@ -150,51 +360,79 @@ func (m *Murre) filter(stats []*k8s.Stats) []*k8s.Stats {
 }
 
 func (m *Murre) sort(stats []*k8s.Stats) {
-	if m.config.SortBy.Mem {
-		sort.Slice(stats, func(i, j int) bool {
-			return stats[i].MemoryBytes > stats[j].MemoryBytes
-		})
-		return
+	// the first enabled sort option wins
+	sorters := []struct {
+		enabled bool
+		less    func(a, b *k8s.Stats) bool
+	}{
+		{m.config.SortBy.Mem, func(a, b *k8s.Stats) bool { return a.MemoryBytes > b.MemoryBytes }},
+		{m.config.SortBy.Cpu, func(a, b *k8s.Stats) bool { return a.CpuUsageMilli > b.CpuUsageMilli }},
+		{m.config.SortBy.CpuUtilization, func(a, b *k8s.Stats) bool { return a.CpuUsagePercent > b.CpuUsagePercent }},
+		{m.config.SortBy.MemUtilization, func(a, b *k8s.Stats) bool { return a.MemoryUsagePercent > b.MemoryUsagePercent }},
+		{m.config.SortBy.CpuRequestRatio, func(a, b *k8s.Stats) bool { return a.CpuRequestPercent > b.CpuRequestPercent }},
+		{m.config.SortBy.MemRequestRatio, func(a, b *k8s.Stats) bool { return a.MemoryRequestPercent > b.MemoryRequestPercent }},
+		{m.config.SortBy.PodName, func(a, b *k8s.Stats) bool { return a.PodName < b.PodName }},
+		{m.config.SortBy.Cluster, func(a, b *k8s.Stats) bool {
+			if a.Cluster != b.Cluster {
+				return a.Cluster < b.Cluster
+			}
+			return a.CpuUsageMilli > b.CpuUsageMilli
+		}},
+		{m.config.SortBy.CpuThrottling, func(a, b *k8s.Stats) bool { return a.CpuThrottledPercent > b.CpuThrottledPercent }},
+		{m.config.SortBy.NetworkRx, func(a, b *k8s.Stats) bool { return a.NetworkRxBytesPerSec > b.NetworkRxBytesPerSec }},
+		{m.config.SortBy.NetworkTx, func(a, b *k8s.Stats) bool { return a.NetworkTxBytesPerSec > b.NetworkTxBytesPerSec }},
+		{m.config.SortBy.NetworkDrops, func(a, b *k8s.Stats) bool { return a.NetworkDroppedPerSec() > b.NetworkDroppedPerSec() }},
+		{m.config.SortBy.FsReads, func(a, b *k8s.Stats) bool { return a.FsReadBytesPerSec > b.FsReadBytesPerSec }},
+		{m.config.SortBy.FsWrites, func(a, b *k8s.Stats) bool { return a.FsWriteBytesPerSec > b.FsWriteBytesPerSec }},
+		{m.config.SortBy.FsUsage, func(a, b *k8s.Stats) bool { return a.FsUsageBytes > b.FsUsageBytes }},
+		{m.config.SortBy.Metric != "", func(a, b *k8s.Stats) bool {
+			return a.Metrics[m.config.SortBy.Metric] > b.Metrics[m.config.SortBy.Metric]
+		}},
 	}
 
-	if m.config.SortBy.Cpu {
-		sort.Slice(stats, func(i, j int) bool {
-			return stats[i].CpuUsageMilli > stats[j].CpuUsageMilli
-		})
-		return
+	//default is to sort by cpu
+	less := func(a, b *k8s.Stats) bool { return a.CpuUsageMilli > b.CpuUsageMilli }
+	for _, sorter := range sorters {
+		if sorter.enabled {
+			less = sorter.less
+			break
+		}
 	}
 
-	if m.config.SortBy.CpuUtilization {
-		sort.Slice(stats, func(i, j int) bool {
-			return stats[i].CpuUsagePercent > stats[j].CpuUsagePercent
-		})
-		return
-	}
+	sort.Slice(stats, func(i, j int) bool {
+		return less(stats[i], stats[j])
+	})
+}
 
-	if m.config.SortBy.MemUtilization {
-		sort.Slice(stats, func(i, j int) bool {
-			return stats[i].MemoryUsagePercent > stats[j].MemoryUsagePercent
-		})
-		return
+// getNodeStats sums up the usage of all containers per node. The container filters do not apply
+// to nodes, but nodes hosting no matching pods are not scraped and are marked as skipped
+func (m *Murre) getNodeStats(stats []*k8s.Stats) ([]*k8s.NodeStats, error) {
+	nodes, err := m.fetcher.GetNodes()
+	if err != nil {
+		return nil, err
 	}
 
-	if m.config.SortBy.PodName {
-		sort.Slice(stats, func(i, j int) bool {
-			return stats[i].PodName < stats[j].PodName
-		})
-		return
+	nodeStats := make([]*k8s.NodeStats, 0, len(nodes))
+	for _, node := range k8s.BuildNodeStats(nodes, stats, m.skippedNodes) {
+		if m.config.Filters.Cluster == "" || m.config.Filters.Cluster == node.Cluster {
+			nodeStats = append(nodeStats, node)
+		}
 	}
 
-	//default is to sort by cpu
-	sort.Slice(stats, func(i, j int) bool {
-		return stats[i].CpuUsageMilli > stats[j].CpuUsageMilli
+	less := func(a, b *k8s.NodeStats) bool { return a.CpuUsagePercent > b.CpuUsagePercent }
+	if m.config.SortBy.Mem || m.config.SortBy.MemUtilization {
+		less = func(a, b *k8s.NodeStats) bool { return a.MemoryUsagePercent > b.MemoryUsagePercent }
+	}
+	sort.Slice(nodeStats, func(i, j int) bool {
+		return less(nodeStats[i], nodeStats[j])
 	})
+	return nodeStats, nil
 }
 
 func (m *Murre) getStats() []*k8s.Stats {
 	containersStats := make([]*k8s.Stats, 0)
 	for _, c := range m.containers {
-		stats := c.GetStats()
+		stats := c.GetStats(m.memoryBasis)
 		if stats == nil {
 			continue
 		}
@@ -206,54 +444,103 @@ func (m *Murre) getStats() []*k8s.Stats {
 
 		containersStats = append(containersStats, stats)
 	}
+
+	for id, p := range m.pods {
+		if time.Since(p.LastUpdateTs()) > 2*time.Minute {
+			delete(m.pods, id)
+		}
+	}
 	return containersStats
 }
 
 func (m *Murre) updateMetrics() error {
-	metrics, err := m.fetcher.GetMetrics()
+	result, err := m.fetcher.GetMetrics()
 	if err != nil {
 		return err
 	}
-	for _, node := range metrics {
-		m.updateCpu(node.Cpu, node.Timestamp)
-		m.updateMemory(node.Memory, node.Timestamp)
+	m.nodeHealth = result.NodeHealth
+	m.skippedNodes = result.SkippedNodes
+	m.updateNodesStatus(result)
+	for _, node := range result.Metrics {
+		m.updateContainerMetrics(node.Cluster, node.NodeName, node.Containers, node.Timestamp)
+		m.updatePodMetrics(node.Cluster, node.Pods, node.Timestamp)
 	}
 	return nil
 }
 
-func (m *Murre) updateCpu(cpu []*k8s.Cpu, fetchTime time.Time) {
-	for _, c := range cpu {
-		container := m.getOrCreateContainerFromCpu(c)
-		container.UpdateCpu(c, fetchTime)
+func (m *Murre) updateNodesStatus(result *k8s.FetchResult) {
+	m.status.Source = result.Source
+	m.status.FallbackFrom = result.FallbackFrom
+	m.status.Nodes = len(result.NodeHealth) + len(result.SkippedNodes)
+	m.status.NodesFailed = result.FailedNodes()
+	m.status.NodesScraped = len(result.NodeHealth) - m.status.NodesFailed
+	m.status.ParseWarnings = result.ParseWarnings()
+	if result.NodeChurn != nil {
+		m.status.LastNodeChurn = result.NodeChurn
 	}
-}
-
-func (m *Murre) updateMemory(memory []*k8s.Memory, fetchTime time.Time) {
-	for _, mem := range memory {
-		container := m.getOrCreateContainerFromMemory(mem)
-		container.UpdateMemory(mem, fetchTime)
+	for _, h := range result.NodeHealth {
+		if h.IsStale() && h.LastErrorTs.After(m.status.LastErrorTs) {
+			m.status.LastError = h.LastError
+			m.status.LastErrorTs = h.LastErrorTs
+		}
+	}
+	for _, err := range result.Errors {
+		m.status.LastError = err
+		m.status.LastErrorTs = time.Now()
 	}
 }
 
-func (m *Murre) getOrCreateContainerFromCpu(cpu *k8s.Cpu) *k8s.Container {
-	return m.getOrCreateContainer(cpu.Name, cpu.Image, cpu.PodName, cpu.Namespace)
+func (m *Murre) updateContainerMetrics(cluster, nodeName string, samples []*k8s.Sample, fetchTime time.Time) {
+	for _, sample := range samples {
+		container := m.getOrCreateContainer(cluster, sample.Name, sample.Image, sample.PodName, sample.Namespace)
+		if nodeName != "" {
+			// metrics-server samples are not tied to a node, the node is taken from the pod spec instead
+			container.NodeName = nodeName
+		}
+		container.Update(sample, fetchTime)
+	}
 }
 
-func (m *Murre) getOrCreateContainerFromMemory(mem *k8s.Memory) *k8s.Container {
-	return m.getOrCreateContainer(mem.Name, mem.Image, mem.PodName, mem.Namespace)
+func (m *Murre) updatePodMetrics(cluster string, samples []*k8s.Sample, fetchTime time.Time) {
+	for _, sample := range samples {
+		pod := m.getOrCreatePod(cluster, sample.PodName, sample.Namespace)
+		pod.Update(sample, fetchTime)
+	}
 }
 
-func (m *Murre) getOrCreateContainer(name, image, podName, namespace string) *k8s.Container {
-	id := fmt.Sprintf("%s/%s/%s", namespace, podName, name)
-	if _, ok := m.containers[id]; !ok {
-		m.containers[id] = &k8s.Container{
+func (m *Murre) getOrCreateContainer(cluster, name, image, podName, namespace string) *k8s.Container {
+	id := fmt.Sprintf("%s/%s/%s/%s", cluster, namespace, podName, name)
+	container, ok := m.containers[id]
+	if !ok {
+		container = &k8s.Container{
 			Id:        id,
+			Cluster:   cluster,
 			Name:      name,
 			Image:     image,
 			PodName:   podName,
 			Namespace: namespace,
 		}
+		if m.historySize > 0 {
+			container.History = k8s.NewHistory(m.historySize)
+		}
+		m.containers[id] = container
+	}
+
+	// the pod is looked up every time, since a pod without samples is removed
+	// and created again while its containers live on, e.g. until it is first scraped
+	container.Pod = m.getOrCreatePod(cluster, podName, namespace)
+	return container
+}
+
+func (m *Murre) getOrCreatePod(cluster, name, namespace string) *k8s.Pod {
+	id := fmt.Sprintf("%s/%s/%s", cluster, namespace, name)
+	if _, ok := m.pods[id]; !ok {
+		m.pods[id] = &k8s.Pod{
+			Id:        id,
+			Name:      name,
+			Namespace: namespace,
+		}
 	}
 
-	return m.containers[id]
+	return m.pods[id]
 }
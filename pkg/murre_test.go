@@ -0,0 +1,150 @@
+package murre
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/groundcover-com/murre/pkg/config"
+	"github.com/groundcover-com/murre/pkg/k8s"
+)
+
+// fakeFetcher returns the same containers on every fetch and the metrics queued in results,
+// an empty fetch once they run out
+type fakeFetcher struct {
+	containers []*k8s.ContainerResources
+	results    []*k8s.FetchResult
+}
+
+func (f *fakeFetcher) Start(stopCh <-chan struct{}) error {
+	return nil
+}
+
+func (f *fakeFetcher) GetMetrics() (*k8s.FetchResult, error) {
+	if len(f.results) == 0 {
+		return &k8s.FetchResult{}, nil
+	}
+	result := f.results[0]
+	f.results = f.results[1:]
+	return result, nil
+}
+
+func (f *fakeFetcher) GetContainers() ([]*k8s.ContainerResources, error) {
+	return f.containers, nil
+}
+
+func (f *fakeFetcher) GetNodes() ([]*k8s.NodeResources, error) {
+	return nil, nil
+}
+
+// fakeUI keeps the stats and the status of the last update
+type fakeUI struct {
+	stats  []*k8s.Stats
+	status *k8s.Status
+}
+
+func (u *fakeUI) Update(stats []*k8s.Stats) {
+	u.stats = stats
+}
+
+func (u *fakeUI) UpdateNodes(nodes []*k8s.NodeStats, containers []*k8s.Stats) {}
+
+func (u *fakeUI) UpdateStatus(status *k8s.Status) {
+	u.status = status
+}
+
+func newTestMurre(fetcher DataFetcher, ui UI) *Murre {
+	return &Murre{
+		fetcher:     fetcher,
+		ui:          ui,
+		config:      &config.Config{},
+		catalog:     k8s.DefaultCatalog(),
+		memoryBasis: k8s.MEMORY_BASIS_WORKING_SET,
+		groupBy:     k8s.GROUP_BY_CONTAINER,
+		containers:  make(map[string]*k8s.Container),
+		pods:        make(map[string]*k8s.Pod),
+		stopCh:      make(chan struct{}),
+	}
+}
+
+func nodeMetrics(ts time.Time, cpuSeconds, rxBytes float64) *k8s.FetchResult {
+	return &k8s.FetchResult{
+		Metrics: []*k8s.NodeMetrics{{
+			NodeName:  "node-1",
+			Timestamp: ts,
+			Metrics: &k8s.Metrics{
+				Containers: []*k8s.Sample{{
+					Name:      "app",
+					PodName:   "api-1",
+					Namespace: "shop",
+					Values: map[string]*k8s.SampleValue{
+						k8s.METRIC_CPU_USAGE:       {Value: cpuSeconds, Kind: k8s.METRIC_KIND_COUNTER, Ts: ts},
+						k8s.METRIC_MEM_WORKING_SET: {Value: 64 * 1024 * 1024, Kind: k8s.METRIC_KIND_GAUGE, Ts: ts},
+					},
+				}},
+				Pods: []*k8s.Sample{{
+					PodName:   "api-1",
+					Namespace: "shop",
+					Values: map[string]*k8s.SampleValue{
+						k8s.METRIC_NET_RX_BYTES: {Value: rxBytes, Kind: k8s.METRIC_KIND_COUNTER, Ts: ts},
+					},
+				}},
+			},
+		}},
+	}
+}
+
+// TestPodMetricsOfContainerCreatedFromSpec covers a pod which is listed before it is first
+// scraped, e.g. a pod started after murre: its pod level metrics must reach its containers
+func TestPodMetricsOfContainerCreatedFromSpec(t *testing.T) {
+	start := time.Now()
+	fetcher := &fakeFetcher{
+		containers: []*k8s.ContainerResources{
+			{PodName: "api-1", Name: "app", Namespace: "shop", NodeName: "node-1"},
+		},
+		results: []*k8s.FetchResult{
+			// the first scrape has no sample of the pod yet
+			{},
+			nodeMetrics(start, 1, 1000),
+			nodeMetrics(start.Add(10*time.Second), 2, 11000),
+		},
+	}
+	ui := &fakeUI{}
+	m := newTestMurre(fetcher, ui)
+
+	for i := 0; i < 3; i++ {
+		if err := m.tick(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(ui.stats) != 1 {
+		t.Fatalf("got %d containers, want 1", len(ui.stats))
+	}
+	if got := ui.stats[0].NetworkRxBytesPerSec; got != 1000 {
+		t.Errorf("got network rx of %v bytes/s, want 1000", got)
+	}
+	if got := ui.stats[0].CpuUsageMilli; got != 100 {
+		t.Errorf("got cpu usage of %vm, want 100m", got)
+	}
+}
+
+func TestLastErrorIsClearedOnRecovery(t *testing.T) {
+	failedNode := &k8s.NodeHealth{NodeName: "node-1", LastError: errors.New("connection refused"), LastErrorTs: time.Now(), ConsecutiveFailures: 1}
+	fetcher := &fakeFetcher{
+		results: []*k8s.FetchResult{
+			{Errors: []error{errors.New("cluster b: unauthorized")}},
+			{NodeHealth: []*k8s.NodeHealth{failedNode}},
+			{NodeHealth: []*k8s.NodeHealth{{NodeName: "node-1", LastSuccessTs: time.Now()}}},
+		},
+	}
+	ui := &fakeUI{}
+	m := newTestMurre(fetcher, ui)
+
+	for i, wantError := range []bool{true, true, false} {
+		m.refresh()
+		if hasError := ui.status.LastError != nil; hasError != wantError {
+			t.Errorf("refresh %d: got error %v, want an error: %v", i+1, ui.status.LastError, wantError)
+		}
+	}
+}
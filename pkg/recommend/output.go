@@ -0,0 +1,194 @@
+package recommend
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Output selects how the recommendations are printed
+type Output string
+
+const (
+	OUTPUT_TABLE Output = "table"
+	OUTPUT_JSON  Output = "json"
+	// kubectl patch commands with a strategic merge patch per workload
+	OUTPUT_PATCH Output = "patch"
+)
+
+func ParseOutput(output string) (Output, error) {
+	switch Output(output) {
+	case OUTPUT_TABLE, OUTPUT_JSON, OUTPUT_PATCH:
+		return Output(output), nil
+	default:
+		return "", fmt.Errorf("unknown output %q, expected one of: %s, %s, %s",
+			output, OUTPUT_TABLE, OUTPUT_JSON, OUTPUT_PATCH)
+	}
+}
+
+// podSpecPaths are the paths of the pod spec in the workloads whose pod template can be patched
+var podSpecPaths = map[string][]string{
+	"Deployment":  {"spec", "template", "spec"},
+	"StatefulSet": {"spec", "template", "spec"},
+	"DaemonSet":   {"spec", "template", "spec"},
+	"ReplicaSet":  {"spec", "template", "spec"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+func Write(w io.Writer, recommendations []*Recommendation, output Output) error {
+	switch output {
+	case OUTPUT_JSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(recommendations)
+	case OUTPUT_PATCH:
+		return writePatches(w, recommendations)
+	default:
+		return writeTable(w, recommendations)
+	}
+}
+
+func writeTable(w io.Writer, recommendations []*Recommendation) error {
+	showCluster := isMultiCluster(recommendations)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := "NAMESPACE\tWORKLOAD\tCONTAINER\tSAMPLES\tCPU REQUEST\tCPU LIMIT\tMEM REQUEST\tMEM LIMIT"
+	if showCluster {
+		header = "CLUSTER\t" + header
+	}
+	fmt.Fprintln(tw, header)
+
+	for _, r := range recommendations {
+		row := fmt.Sprintf("%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s",
+			r.Namespace,
+			r.Workload,
+			r.Container,
+			r.Samples,
+			formatChange(formatCpu(r.Current.CpuRequestMilli), formatCpu(r.Recommended.CpuRequestMilli)),
+			formatChange(formatCpu(r.Current.CpuLimitMilli), formatCpu(r.Recommended.CpuLimitMilli)),
+			formatChange(formatMemory(r.Current.MemoryRequestBytes), formatMemory(r.Recommended.MemoryRequestBytes)),
+			formatChange(formatMemory(r.Current.MemoryLimitBytes), formatMemory(r.Recommended.MemoryLimitBytes)),
+		)
+		if showCluster {
+			row = r.Cluster + "\t" + row
+		}
+		fmt.Fprintln(tw, row)
+	}
+	return tw.Flush()
+}
+
+// writePatches prints a kubectl patch command per workload. Pods and Jobs are
+// listed as comments, since the resources of their pods can not be changed
+func writePatches(w io.Writer, recommendations []*Recommendation) error {
+	for _, workload := range groupByWorkload(recommendations) {
+		first := workload[0]
+		kind, name, _ := strings.Cut(first.Workload, "/")
+		path, ok := podSpecPaths[kind]
+		if !ok {
+			if _, err := fmt.Fprintf(w, "# %s/%s: the pods of a %s can not be patched, update the manifest they were created from\n", first.Namespace, first.Workload, kind); err != nil {
+				return err
+			}
+			continue
+		}
+
+		patch, err := json.Marshal(buildPatch(path, workload))
+		if err != nil {
+			return err
+		}
+		command := "kubectl"
+		// the patch is meant for the cluster the usage was collected from
+		if first.Cluster != "" {
+			command += " --context " + first.Cluster
+		}
+		command += fmt.Sprintf(" -n %s patch %s %s --patch '%s'", first.Namespace, strings.ToLower(kind), name, patch)
+		if _, err := fmt.Fprintln(w, command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildPatch builds a strategic merge patch setting the resources of the containers,
+// containers are merged by name so the other fields of the pod spec stay untouched
+func buildPatch(path []string, recommendations []*Recommendation) map[string]interface{} {
+	containers := make([]map[string]interface{}, 0, len(recommendations))
+	for _, r := range recommendations {
+		requests := map[string]string{
+			"cpu":    formatCpuQuantity(r.Recommended.CpuRequestMilli),
+			"memory": formatMemoryQuantity(r.Recommended.MemoryRequestBytes),
+		}
+		limits := map[string]string{
+			"memory": formatMemoryQuantity(r.Recommended.MemoryLimitBytes),
+		}
+		if r.Recommended.CpuLimitMilli > 0 {
+			limits["cpu"] = formatCpuQuantity(r.Recommended.CpuLimitMilli)
+		}
+		containers = append(containers, map[string]interface{}{
+			"name": r.Container,
+			"resources": map[string]interface{}{
+				"requests": requests,
+				"limits":   limits,
+			},
+		})
+	}
+
+	patch := map[string]interface{}{"containers": containers}
+	for i := len(path) - 1; i >= 0; i-- {
+		patch = map[string]interface{}{path[i]: patch}
+	}
+	return patch
+}
+
+// groupByWorkload splits the sorted recommendations into the containers of every workload
+func groupByWorkload(recommendations []*Recommendation) [][]*Recommendation {
+	workloads := make([][]*Recommendation, 0)
+	for i, r := range recommendations {
+		if i > 0 {
+			previous := recommendations[i-1]
+			if previous.Cluster == r.Cluster && previous.Namespace == r.Namespace && previous.Workload == r.Workload {
+				workloads[len(workloads)-1] = append(workloads[len(workloads)-1], r)
+				continue
+			}
+		}
+		workloads = append(workloads, []*Recommendation{r})
+	}
+	return workloads
+}
+
+func isMultiCluster(recommendations []*Recommendation) bool {
+	for _, r := range recommendations {
+		if r.Cluster != recommendations[0].Cluster {
+			return true
+		}
+	}
+	return false
+}
+
+func formatChange(current, recommended string) string {
+	return current + " -> " + recommended
+}
+
+func formatCpu(milli float64) string {
+	if milli <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0fm", milli)
+}
+
+func formatMemory(bytes float64) string {
+	if bytes <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0fMi", bytes/MIB)
+}
+
+func formatCpuQuantity(milli float64) string {
+	return resource.NewMilliQuantity(int64(milli), resource.DecimalSI).String()
+}
+
+func formatMemoryQuantity(bytes float64) string {
+	return resource.NewQuantity(int64(bytes), resource.BinarySI).String()
+}
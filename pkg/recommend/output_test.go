@@ -0,0 +1,86 @@
+package recommend
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestBuildPatch(t *testing.T) {
+	recommendations := []*Recommendation{
+		{Container: "app", Recommended: Resources{CpuRequestMilli: 250, CpuLimitMilli: 1000, MemoryRequestBytes: 128 * MIB, MemoryLimitBytes: 256 * MIB}},
+		{Container: "sidecar", Recommended: Resources{CpuRequestMilli: MIN_CPU_REQUEST_MILLI, MemoryRequestBytes: 16 * MIB, MemoryLimitBytes: 32 * MIB}},
+	}
+
+	tests := []struct {
+		kind string
+		want string
+	}{
+		{
+			kind: "Deployment",
+			want: `{"spec":{"template":{"spec":{"containers":[` +
+				`{"name":"app","resources":{"limits":{"cpu":"1","memory":"256Mi"},"requests":{"cpu":"250m","memory":"128Mi"}}},` +
+				`{"name":"sidecar","resources":{"limits":{"memory":"32Mi"},"requests":{"cpu":"10m","memory":"16Mi"}}}]}}}}`,
+		},
+		{
+			kind: "CronJob",
+			want: `{"spec":{"jobTemplate":{"spec":{"template":{"spec":{"containers":[` +
+				`{"name":"app","resources":{"limits":{"cpu":"1","memory":"256Mi"},"requests":{"cpu":"250m","memory":"128Mi"}}},` +
+				`{"name":"sidecar","resources":{"limits":{"memory":"32Mi"},"requests":{"cpu":"10m","memory":"16Mi"}}}]}}}}}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.kind, func(t *testing.T) {
+			patch, err := json.Marshal(buildPatch(podSpecPaths[test.kind], recommendations))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(patch) != test.want {
+				t.Errorf("got patch\n%s\nwant\n%s", patch, test.want)
+			}
+		})
+	}
+}
+
+func TestWritePatches(t *testing.T) {
+	recommendations := []*Recommendation{
+		{Cluster: "prod", Namespace: "shop", Workload: "Deployment/api", Container: "app", Recommended: Resources{CpuRequestMilli: 100, MemoryRequestBytes: 64 * MIB, MemoryLimitBytes: 64 * MIB}},
+		{Namespace: "shop", Workload: "Pod/debug", Container: "shell", Recommended: Resources{CpuRequestMilli: 10, MemoryRequestBytes: 8 * MIB, MemoryLimitBytes: 8 * MIB}},
+	}
+
+	var out bytes.Buffer
+	if err := Write(&out, recommendations, OUTPUT_PATCH); err != nil {
+		t.Fatal(err)
+	}
+	want := `kubectl --context prod -n shop patch deployment api --patch '{"spec":{"template":{"spec":{"containers":[{"name":"app","resources":{"limits":{"memory":"64Mi"},"requests":{"cpu":"100m","memory":"64Mi"}}}]}}}}'` + "\n" +
+		"# shop/Pod/debug: the pods of a Pod can not be patched, update the manifest they were created from\n"
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+// TestOutputsAgree checks that the minimal cpu request of an idle container shows
+// up the same way in the table, in JSON and in the patch
+func TestOutputsAgree(t *testing.T) {
+	recommendations := []*Recommendation{
+		{Namespace: "shop", Workload: "Deployment/idle", Container: "app", Samples: 3,
+			Current:     Resources{CpuRequestMilli: 100, MemoryRequestBytes: 64 * MIB},
+			Recommended: Resources{CpuRequestMilli: MIN_CPU_REQUEST_MILLI, MemoryRequestBytes: 12 * MIB, MemoryLimitBytes: 12 * MIB}},
+	}
+
+	for output, want := range map[Output]string{
+		OUTPUT_TABLE: "100m -> 10m",
+		OUTPUT_JSON:  `"cpuRequestMilli": 10`,
+		OUTPUT_PATCH: `"requests":{"cpu":"10m"`,
+	} {
+		var out bytes.Buffer
+		if err := Write(&out, recommendations, output); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("%s output %q does not contain %q", output, out.String(), want)
+		}
+	}
+}
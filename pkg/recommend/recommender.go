@@ -0,0 +1,225 @@
+package recommend
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/groundcover-com/murre/pkg/config"
+	"github.com/groundcover-com/murre/pkg/k8s"
+)
+
+const (
+	MIB = 1024 * 1024
+	// lowest cpu request recommended, so that mostly idle containers keep a cpu guarantee
+	MIN_CPU_REQUEST_MILLI = 10
+)
+
+// Resources holds requests and limits, cpu in millicores and memory in bytes. 0 means not set
+type Resources struct {
+	CpuRequestMilli    float64 `json:"cpuRequestMilli"`
+	CpuLimitMilli      float64 `json:"cpuLimitMilli"`
+	MemoryRequestBytes float64 `json:"memoryRequestBytes"`
+	MemoryLimitBytes   float64 `json:"memoryLimitBytes"`
+}
+
+// Usage summarizes the usage distribution of a container over the window
+type Usage struct {
+	CpuPercentileMilli    float64 `json:"cpuPercentileMilli"`
+	CpuMaxMilli           float64 `json:"cpuMaxMilli"`
+	MemoryPercentileBytes float64 `json:"memoryPercentileBytes"`
+	MemoryMaxBytes        float64 `json:"memoryMaxBytes"`
+}
+
+// Recommendation suggests the resources of a container of a workload, all replicas
+// of the workload contribute to the usage since they share the same spec
+type Recommendation struct {
+	Cluster     string    `json:"cluster,omitempty"`
+	Namespace   string    `json:"namespace"`
+	Workload    string    `json:"workload"`
+	Container   string    `json:"container"`
+	Samples     int       `json:"samples"`
+	Usage       Usage     `json:"usage"`
+	Current     Resources `json:"current"`
+	Recommended Resources `json:"recommended"`
+}
+
+// usage collects the samples of a container of a workload
+type usage struct {
+	cluster   string
+	namespace string
+	workload  string
+	container string
+	// cpu in millicores and memory in bytes
+	cpu     []float64
+	memory  []float64
+	current Resources
+}
+
+// Recommender collects the usage of the containers while murre refreshes and suggests
+// requests and limits out of it. It takes the place of the UI, so the containers are
+// filtered the same way as in the table
+type Recommender struct {
+	config config.Recommend
+	mu     sync.Mutex
+	usage  map[string]*usage
+	// last update of every container, a sample is recorded once even if a node was not scraped again
+	lastUpdates map[string]time.Time
+	status      *k8s.Status
+}
+
+func NewRecommender(recommendConfig config.Recommend) (*Recommender, error) {
+	if recommendConfig.Window <= 0 {
+		return nil, fmt.Errorf("window must be positive, got %s", recommendConfig.Window)
+	}
+	if recommendConfig.Percentile <= 0 || recommendConfig.Percentile > 100 {
+		return nil, fmt.Errorf("percentile must be between 0 and 100, got %g", recommendConfig.Percentile)
+	}
+	if recommendConfig.Headroom < 0 || recommendConfig.Margin < 0 {
+		return nil, fmt.Errorf("headroom and margin must not be negative")
+	}
+
+	return &Recommender{
+		config:      recommendConfig,
+		usage:       make(map[string]*usage),
+		lastUpdates: make(map[string]time.Time),
+	}, nil
+}
+
+func (r *Recommender) Update(stats []*k8s.Stats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range stats {
+		id := fmt.Sprintf("%s/%s/%s/%s", s.Cluster, s.Namespace, s.PodName, s.ContainerName)
+		if !s.LastUpdateTs.After(r.lastUpdates[id]) {
+			continue
+		}
+		isFirstUpdate := r.lastUpdates[id].IsZero()
+		r.lastUpdates[id] = s.LastUpdateTs
+
+		key := fmt.Sprintf("%s/%s/%s/%s", s.Cluster, s.Namespace, s.Workload, s.ContainerName)
+		u, ok := r.usage[key]
+		if !ok {
+			u = &usage{
+				cluster:   s.Cluster,
+				namespace: s.Namespace,
+				workload:  s.Workload,
+				container: s.ContainerName,
+			}
+			r.usage[key] = u
+		}
+		// the cpu usage is a rate, it is known from the second update of the container on.
+		// Idle samples are recorded as 0, otherwise the percentile of a mostly idle container is skewed up
+		if !isFirstUpdate {
+			u.cpu = append(u.cpu, s.CpuUsageMilli)
+		}
+		if s.MemoryBytes > 0 {
+			u.memory = append(u.memory, s.MemoryBytes)
+		}
+		u.current = Resources{
+			CpuRequestMilli:    s.CpuRequest,
+			CpuLimitMilli:      s.CpuLimit,
+			MemoryRequestBytes: s.MemoryRequestBytes,
+			MemoryLimitBytes:   s.MemoryLimitBytes,
+		}
+	}
+}
+
+func (r *Recommender) UpdateNodes(nodes []*k8s.NodeStats, containers []*k8s.Stats) {}
+
+func (r *Recommender) UpdateStatus(status *k8s.Status) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+}
+
+// Recommendations returns a recommendation for every container with both cpu and memory
+// samples, sorted by cluster, namespace, workload and container. It fails when no
+// container was sampled, with the last error murre ran into if there was one
+func (r *Recommender) Recommendations() ([]*Recommendation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	recommendations := make([]*Recommendation, 0, len(r.usage))
+	for _, u := range r.usage {
+		if len(u.cpu) == 0 || len(u.memory) == 0 {
+			continue
+		}
+		recommendations = append(recommendations, r.recommend(u))
+	}
+
+	if len(recommendations) == 0 {
+		if r.status != nil && r.status.LastError != nil {
+			return nil, fmt.Errorf("no container usage was collected: %w", r.status.LastError)
+		}
+		return nil, fmt.Errorf("no container usage was collected, check the filters or use a longer window")
+	}
+
+	sort.Slice(recommendations, func(i, j int) bool {
+		a, b := recommendations[i], recommendations[j]
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Workload != b.Workload {
+			return a.Workload < b.Workload
+		}
+		return a.Container < b.Container
+	})
+	return recommendations, nil
+}
+
+// recommend bases the requests on a percentile of the usage plus headroom and the limits on
+// the maximal usage plus a margin. The cpu request is at least MIN_CPU_REQUEST_MILLI and
+// a cpu limit is only recommended for containers which already have one, since a cpu
+// limit throttles the container even when the node is idle
+func (r *Recommender) recommend(u *usage) *Recommendation {
+	observed := Usage{
+		CpuPercentileMilli:    percentile(u.cpu, r.config.Percentile),
+		CpuMaxMilli:           percentile(u.cpu, 100),
+		MemoryPercentileBytes: percentile(u.memory, r.config.Percentile),
+		MemoryMaxBytes:        percentile(u.memory, 100),
+	}
+
+	recommended := Resources{
+		CpuRequestMilli:    math.Max(addPercent(observed.CpuPercentileMilli, r.config.Headroom, 1), MIN_CPU_REQUEST_MILLI),
+		MemoryRequestBytes: addPercent(observed.MemoryPercentileBytes, r.config.Headroom, MIB),
+	}
+	recommended.MemoryLimitBytes = math.Max(addPercent(observed.MemoryMaxBytes, r.config.Margin, MIB), recommended.MemoryRequestBytes)
+	if u.current.CpuLimitMilli > 0 {
+		recommended.CpuLimitMilli = math.Max(addPercent(observed.CpuMaxMilli, r.config.Margin, 1), recommended.CpuRequestMilli)
+	}
+
+	return &Recommendation{
+		Cluster:     u.cluster,
+		Namespace:   u.namespace,
+		Workload:    u.workload,
+		Container:   u.container,
+		Samples:     len(u.memory),
+		Usage:       observed,
+		Current:     u.current,
+		Recommended: recommended,
+	}
+}
+
+// addPercent adds percent to the value and rounds it up to a multiple of unit. The value is
+// multiplied by the whole percentage, since e.g. 100 * 1.1 is slightly above 110 in floating point
+func addPercent(value, percent, unit float64) float64 {
+	return math.Ceil(value*(100+percent)/100/unit) * unit
+}
+
+// percentile returns the nearest-rank percentile of the values
+func percentile(values []float64, p float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
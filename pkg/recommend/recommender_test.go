@@ -0,0 +1,128 @@
+package recommend
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/groundcover-com/murre/pkg/config"
+	"github.com/groundcover-com/murre/pkg/k8s"
+)
+
+func TestPercentile(t *testing.T) {
+	oneToTen := []float64{7, 3, 10, 1, 5, 2, 9, 4, 8, 6}
+	tests := []struct {
+		name   string
+		values []float64
+		p      float64
+		want   float64
+	}{
+		{name: "median", values: oneToTen, p: 50, want: 5},
+		{name: "rank rounded up", values: oneToTen, p: 95, want: 10},
+		{name: "rank between samples", values: oneToTen, p: 91, want: 10},
+		{name: "maximum", values: oneToTen, p: 100, want: 10},
+		{name: "lowest rank is the minimum", values: oneToTen, p: 1, want: 1},
+		{name: "single sample", values: []float64{42}, p: 95, want: 42},
+		{name: "idle samples", values: []float64{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 250}, p: 95, want: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := append([]float64{}, test.values...)
+			if got := percentile(values, test.p); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+			if !reflect.DeepEqual(values, test.values) {
+				t.Errorf("the values were reordered to %v", values)
+			}
+		})
+	}
+}
+
+func TestRecommend(t *testing.T) {
+	recommender, err := NewRecommender(config.Recommend{Window: time.Minute, Percentile: 95, Headroom: 20, Margin: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		cpu     []float64
+		memory  []float64
+		current Resources
+		want    Resources
+	}{
+		{
+			name:   "headroom and margin",
+			cpu:    []float64{100},
+			memory: []float64{100 * MIB},
+			want:   Resources{CpuRequestMilli: 120, MemoryRequestBytes: 120 * MIB, MemoryLimitBytes: 120 * MIB},
+		},
+		{
+			name:    "limits are at least the requests",
+			cpu:     []float64{50, 100},
+			memory:  []float64{50 * MIB, 150 * MIB},
+			current: Resources{CpuLimitMilli: 1000},
+			want:    Resources{CpuRequestMilli: 120, CpuLimitMilli: 120, MemoryRequestBytes: 180 * MIB, MemoryLimitBytes: 180 * MIB},
+		},
+		{
+			name:    "margin without floating point noise",
+			cpu:     []float64{10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 100},
+			memory:  []float64{100 * MIB, 100 * MIB, 100 * MIB, 100 * MIB, 100 * MIB, 100 * MIB, 100 * MIB, 100 * MIB, 100 * MIB, 100 * MIB, 100 * MIB, 100 * MIB, 100 * MIB, 100 * MIB, 100 * MIB, 100 * MIB, 100 * MIB, 100 * MIB, 100 * MIB, 200 * MIB},
+			current: Resources{CpuLimitMilli: 1000},
+			want:    Resources{CpuRequestMilli: 12, CpuLimitMilli: 110, MemoryRequestBytes: 120 * MIB, MemoryLimitBytes: 220 * MIB},
+		},
+		{
+			name:   "rounded up to millicores and MiB",
+			cpu:    []float64{33.3},
+			memory: []float64{100.5 * MIB},
+			want:   Resources{CpuRequestMilli: 40, MemoryRequestBytes: 121 * MIB, MemoryLimitBytes: 121 * MIB},
+		},
+		{
+			name:    "idle container keeps a cpu request",
+			cpu:     []float64{0, 0, 0},
+			memory:  []float64{10 * MIB},
+			current: Resources{CpuRequestMilli: 100, CpuLimitMilli: 200},
+			want:    Resources{CpuRequestMilli: MIN_CPU_REQUEST_MILLI, CpuLimitMilli: MIN_CPU_REQUEST_MILLI, MemoryRequestBytes: 12 * MIB, MemoryLimitBytes: 12 * MIB},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := recommender.recommend(&usage{cpu: test.cpu, memory: test.memory, current: test.current})
+			if got.Recommended != test.want {
+				t.Errorf("got %+v, want %+v", got.Recommended, test.want)
+			}
+		})
+	}
+}
+
+func TestUpdateRecordsIdleCpuOnceTheRateIsKnown(t *testing.T) {
+	recommender, err := NewRecommender(config.Recommend{Window: time.Minute, Percentile: 95})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		recommender.Update([]*k8s.Stats{{
+			Namespace:     "shop",
+			PodName:       "api-1",
+			ContainerName: "app",
+			Workload:      "Deployment/api",
+			MemoryBytes:   64 * MIB,
+			LastUpdateTs:  start.Add(time.Duration(i) * 10 * time.Second),
+		}})
+	}
+
+	recommendations, err := recommender.Recommendations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := recommendations[0]; got.Samples != 3 || got.Usage.CpuMaxMilli != 0 || got.Recommended.CpuRequestMilli != MIN_CPU_REQUEST_MILLI {
+		t.Errorf("got %d samples, %vm max cpu and a %vm cpu request, want 3 samples, 0m and %vm", got.Samples, got.Usage.CpuMaxMilli, got.Recommended.CpuRequestMilli, MIN_CPU_REQUEST_MILLI)
+	}
+	if got := len(recommender.usage["/shop/Deployment/api/app"].cpu); got != 2 {
+		t.Errorf("got %d cpu samples, want 2 since the cpu is unknown on the first update", got)
+	}
+}
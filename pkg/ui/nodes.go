@@ -0,0 +1,156 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/groundcover-com/murre/pkg/k8s"
+	"github.com/rivo/tview"
+)
+
+const (
+	VIEW_CONTAINERS = "containers"
+	VIEW_NODES      = "nodes"
+)
+
+var (
+	Views = []string{VIEW_CONTAINERS, VIEW_NODES}
+)
+
+// SetView selects the view shown until the user switches it with the 'n' key
+func (t *Table) SetView(view string) error {
+	switch view {
+	case VIEW_CONTAINERS, VIEW_NODES:
+		t.view = view
+		return nil
+	default:
+		return fmt.Errorf("unknown view %q, expected one of: %s", view, strings.Join(Views, ", "))
+	}
+}
+
+func (t *Table) UpdateNodes(nodes []*k8s.NodeStats, containers []*k8s.Stats) {
+	t.app.QueueUpdateDraw(func() {
+		t.nodes = nodes
+		t.containers = containers
+		if t.view == VIEW_NODES || t.drillDown != nil {
+			t.render()
+		}
+	})
+}
+
+// handleKey switches between the views: 'n' toggles the node view, enter on a node shows
+// the containers of the node and escape goes back from there to the node view.
+// It returns false for keys it does not handle
+func (t *Table) handleKey(event *tcell.EventKey) bool {
+	switch {
+	case event.Rune() == 'n' || event.Rune() == 'N':
+		if t.view == VIEW_NODES {
+			t.view = VIEW_CONTAINERS
+		} else {
+			t.view = VIEW_NODES
+		}
+		t.drillDown = nil
+	case event.Key() == tcell.KeyEnter && t.view == VIEW_NODES:
+		row, _ := t.table.GetSelection()
+		if row < 1 || row > len(t.nodes) {
+			return true
+		}
+		t.drillDown = t.nodes[row-1]
+		t.view = VIEW_CONTAINERS
+	case event.Key() == tcell.KeyEscape && t.drillDown != nil:
+		t.drillDown = nil
+		t.view = VIEW_NODES
+	default:
+		return false
+	}
+
+	t.render()
+	return true
+}
+
+// render redraws the current view out of the last stats
+func (t *Table) render() {
+	t.table.Clear()
+	if t.view == VIEW_NODES {
+		t.table.SetSelectable(true, false)
+		t.renderNodes()
+		return
+	}
+
+	t.table.SetSelectable(false, false)
+	stats, columns := t.stats, t.columns
+	if t.drillDown != nil {
+		stats, columns = t.getNodeContainers(), t.containerColumns
+	}
+	t.updateColumns(columns)
+	t.updateHistoryLength(stats)
+	for i, stat := range stats {
+		for j, column := range columns {
+			t.table.SetCell(i+1, j, t.getCell(stat, column).SetExpansion(1))
+		}
+	}
+	t.table.ScrollToBeginning()
+}
+
+// getNodeContainers returns the containers of the drilled down node. The containers are
+// taken ungrouped, since the groups other than nodes may span several nodes
+func (t *Table) getNodeContainers() []*k8s.Stats {
+	containers := make([]*k8s.Stats, 0)
+	for _, stat := range t.containers {
+		if stat.Cluster == t.drillDown.Cluster && stat.NodeName == t.drillDown.NodeName {
+			containers = append(containers, stat)
+		}
+	}
+	return containers
+}
+
+func (t *Table) renderNodes() {
+	titles := []string{"Node", "CPU", "Memory", "CPU Requests", "Mem Requests", "Pods", "Top Consumer"}
+	showCluster := contains(t.columns, COLUMN_CLUSTER)
+	if showCluster {
+		titles = append([]string{columnTitles[COLUMN_CLUSTER]}, titles...)
+	}
+	for i, title := range titles {
+		t.table.SetCell(0, i, t.createColumnCell(title).SetSelectable(false))
+	}
+
+	for i, node := range t.nodes {
+		cells := []*tview.TableCell{
+			tview.NewTableCell(node.NodeName),
+			t.getNodeUsageCell(node, fmt.Sprintf("%.0f/%.0fmCPU", node.CpuUsageMilli, node.CpuAllocatable), node.CpuUsagePercent),
+			t.getNodeUsageCell(node, fmt.Sprintf("%.0f/%.0fMiB", node.MemoryBytes/1024/1024, node.MemoryAllocatableBytes/1024/1024), node.MemoryUsagePercent),
+			t.getNodeRequestsCell(fmt.Sprintf("%.0f/%.0fmCPU", node.CpuRequest, node.CpuAllocatable), node.CpuRequestPercent),
+			t.getNodeRequestsCell(fmt.Sprintf("%.0f/%.0fMiB", node.MemoryRequestBytes/1024/1024, node.MemoryAllocatableBytes/1024/1024), node.MemoryRequestPercent),
+			tview.NewTableCell(fmt.Sprintf("%d", node.Pods)),
+			tview.NewTableCell(node.TopConsumer),
+		}
+		if node.Skipped {
+			cells[len(cells)-1] = tview.NewTableCell("not scraped").SetTextColor(tcell.ColorGray)
+		}
+		if showCluster {
+			cells = append([]*tview.TableCell{tview.NewTableCell(node.Cluster)}, cells...)
+		}
+		for j, cell := range cells {
+			t.table.SetCell(i+1, j, cell.SetExpansion(1))
+		}
+	}
+}
+
+// getNodeUsageCell shows the usage of a node, which is unknown for nodes that were skipped
+// because they host no pods matching the filters
+func (t *Table) getNodeUsageCell(node *k8s.NodeStats, text string, percent float64) *tview.TableCell {
+	if node.Skipped {
+		return tview.NewTableCell("-").SetAlign(tview.AlignCenter)
+	}
+	return tview.NewTableCell(fmt.Sprintf("%s (%.1f%%)", text, percent)).SetTextColor(t.getCellColor(percent))
+}
+
+// getNodeRequestsCell marks overcommitted nodes, whose pods requested more than the node can allocate
+func (t *Table) getNodeRequestsCell(text string, percent float64) *tview.TableCell {
+	color := tcell.ColorWhite
+	if percent > 100 {
+		color = tcell.ColorRed
+	}
+	return tview.NewTableCell(fmt.Sprintf("%s (%.1f%%)", text, percent)).SetTextColor(color)
+}
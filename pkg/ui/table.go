@@ -2,6 +2,9 @@ package ui
 
 import (
 	"fmt"
+	"math"
+	"strings"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/groundcover-com/murre/pkg/k8s"
@@ -9,16 +12,151 @@ import (
 	"github.com/rivo/tview"
 )
 
+const (
+	STATUS_TIME_FORMAT = "15:04:05"
+)
+
+const (
+	COLUMN_CLUSTER    = "cluster"
+	COLUMN_NAMESPACE  = "namespace"
+	COLUMN_POD        = "pod"
+	COLUMN_CONTAINER  = "container"
+	COLUMN_WORKLOAD   = "workload"
+	COLUMN_NODE       = "node"
+	COLUMN_CPU        = "cpu"
+	COLUMN_MEMORY     = "memory"
+	COLUMN_THROTTLING = "cpu-throttling"
+	COLUMN_CPU_REQ    = "cpu-request"
+	COLUMN_MEM_REQ    = "memory-request"
+	COLUMN_CPU_USER   = "cpu-user"
+	COLUMN_CPU_SYSTEM = "cpu-system"
+	COLUMN_MEM_USAGE  = "memory-usage"
+	COLUMN_MEM_WSS    = "memory-working-set"
+	COLUMN_MEM_RSS    = "memory-rss"
+	COLUMN_MEM_CACHE  = "memory-cache"
+	COLUMN_NET_RX     = "net-rx"
+	COLUMN_NET_TX     = "net-tx"
+	COLUMN_NET_DROPS  = "net-drops"
+	COLUMN_FS_READS   = "fs-reads"
+	COLUMN_FS_WRITES  = "fs-writes"
+	COLUMN_FS_USAGE   = "fs-usage"
+)
+
+var (
+	DefaultColumns = []string{COLUMN_NAMESPACE, COLUMN_POD, COLUMN_CONTAINER, COLUMN_CPU, COLUMN_MEMORY, COLUMN_THROTTLING}
+	// columns naming the rows when the containers are grouped, they replace the
+	// namespace, pod and container columns of the default columns
+	groupColumns = map[k8s.GroupBy][]string{
+		k8s.GROUP_BY_POD:       {COLUMN_NAMESPACE, COLUMN_POD},
+		k8s.GROUP_BY_WORKLOAD:  {COLUMN_NAMESPACE, COLUMN_WORKLOAD},
+		k8s.GROUP_BY_NAMESPACE: {COLUMN_NAMESPACE},
+		k8s.GROUP_BY_NODE:      {COLUMN_NODE},
+	}
+	// columns which are shown only when requested
+	OptionalColumns = []string{
+		COLUMN_CLUSTER,
+		COLUMN_NODE,
+		COLUMN_CPU_REQ,
+		COLUMN_MEM_REQ,
+		COLUMN_CPU_USER,
+		COLUMN_CPU_SYSTEM,
+		COLUMN_MEM_USAGE,
+		COLUMN_MEM_WSS,
+		COLUMN_MEM_RSS,
+		COLUMN_MEM_CACHE,
+		COLUMN_NET_RX,
+		COLUMN_NET_TX,
+		COLUMN_NET_DROPS,
+		COLUMN_FS_READS,
+		COLUMN_FS_WRITES,
+		COLUMN_FS_USAGE,
+	}
+)
+
+var columnTitles = map[string]string{
+	COLUMN_CLUSTER:    "Cluster",
+	COLUMN_NAMESPACE:  "Namespace",
+	COLUMN_POD:        "Pod",
+	COLUMN_CONTAINER:  "Container",
+	COLUMN_WORKLOAD:   "Workload",
+	COLUMN_NODE:       "Node",
+	COLUMN_CPU:        "CPU",
+	COLUMN_MEMORY:     "Memory",
+	COLUMN_THROTTLING: "Throttled",
+	COLUMN_CPU_REQ:    "CPU/Request",
+	COLUMN_MEM_REQ:    "Mem/Request",
+	COLUMN_CPU_USER:   "CPU User",
+	COLUMN_CPU_SYSTEM: "CPU System",
+	COLUMN_MEM_USAGE:  "Mem Usage",
+	COLUMN_MEM_WSS:    "Mem Working Set",
+	COLUMN_MEM_RSS:    "Mem RSS",
+	COLUMN_MEM_CACHE:  "Mem Cache",
+	COLUMN_NET_RX:     "Pod Net RX",
+	COLUMN_NET_TX:     "Pod Net TX",
+	COLUMN_NET_DROPS:  "Pod Net Drops",
+	COLUMN_FS_READS:   "FS Reads",
+	COLUMN_FS_WRITES:  "FS Writes",
+	COLUMN_FS_USAGE:   "FS Usage",
+}
+
 type Table struct {
-	app   *tview.Application
-	table *tview.Table
+	app       *tview.Application
+	table     *tview.Table
+	statusBar *tview.TextView
+	columns   []string
+	catalog   *k8s.MetricCatalog
+	view      string
+	// last stats, kept to redraw the table when the view changes
+	stats []*k8s.Stats
+	nodes []*k8s.NodeStats
+	// last ungrouped containers and the columns to show them with, for the drill-down into a node
+	containers       []*k8s.Stats
+	containerColumns []string
+	// node whose containers are shown, nil when all containers are shown
+	drillDown *k8s.NodeStats
+	// width of the sparklines, the length of the longest history
+	historyLength int
 }
 
-func CreateNewTable() *Table {
+// CreateNewTable creates a table showing the default columns followed by extraColumns,
+// which must be taken from OptionalColumns or be keys of metrics in the catalog.
+// When the containers are grouped, the columns naming the group replace the namespace,
+// pod and container columns. The cluster column is always shown first
+func CreateNewTable(groupBy k8s.GroupBy, extraColumns []string, catalog *k8s.MetricCatalog) (*Table, error) {
+	columns := append([]string{}, DefaultColumns...)
+	if names, ok := groupColumns[groupBy]; ok {
+		columns = append(append([]string{}, names...), COLUMN_CPU, COLUMN_MEMORY, COLUMN_THROTTLING)
+	}
+	columns, err := addColumns(columns, extraColumns, catalog)
+	if err != nil {
+		return nil, err
+	}
+	// the drill-down into a node always shows containers
+	containerColumns, err := addColumns(append([]string{}, DefaultColumns...), extraColumns, catalog)
+	if err != nil {
+		return nil, err
+	}
+
 	table := tview.NewTable().SetSeparator(tview.Borders.Vertical)
+	statusBar := tview.NewTextView().SetDynamicColors(true).SetText("Waiting for first refresh...")
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(table, 0, 1, true).
+		AddItem(statusBar, 1, 0, false)
 	app := tview.NewApplication()
-	app.SetRoot(table, true).EnableMouse(false)
+	app.SetRoot(layout, true).EnableMouse(false)
+	t := &Table{
+		app:              app,
+		table:            table,
+		statusBar:        statusBar,
+		columns:          columns,
+		containerColumns: containerColumns,
+		catalog:          catalog,
+		view:             VIEW_CONTAINERS,
+	}
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if t.handleKey(event) {
+			return nil
+		}
 		if event.Key() == tcell.KeyEscape ||
 			event.Key() == tcell.KeyCtrlC ||
 			event.Rune() == 'Q' ||
@@ -27,10 +165,37 @@ func CreateNewTable() *Table {
 		}
 		return event
 	})
-	return &Table{
-		app:   app,
-		table: table,
+	return t, nil
+}
+
+func addColumns(columns []string, extraColumns []string, catalog *k8s.MetricCatalog) ([]string, error) {
+	for _, column := range extraColumns {
+		if contains(columns, column) {
+			continue
+		}
+		if !isOptionalColumn(column) && catalog.Metric(column) == nil {
+			return nil, fmt.Errorf("unknown column %q, available columns: %s or the key of a metric in the metrics catalog", column, strings.Join(OptionalColumns, ", "))
+		}
+		if column == COLUMN_CLUSTER {
+			columns = append([]string{COLUMN_CLUSTER}, columns...)
+			continue
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+func isOptionalColumn(column string) bool {
+	return contains(OptionalColumns, column)
+}
+
+func contains(columns []string, column string) bool {
+	for _, c := range columns {
+		if c == column {
+			return true
+		}
 	}
+	return false
 }
 
 func (t *Table) Draw() error {
@@ -39,48 +204,115 @@ func (t *Table) Draw() error {
 
 func (t *Table) Update(stats []*k8s.Stats) {
 	t.app.QueueUpdateDraw(func() {
-		t.table.Clear()
-		t.updateColumns()
-		for i, stat := range stats {
-			for j := 0; j < 5; j++ {
-				t.table.SetCell(i+1, j, t.getCell(stat, j).SetExpansion(1))
-			}
-		}
-		t.table.ScrollToBeginning()
+		t.stats = stats
+		if t.view == VIEW_CONTAINERS && t.drillDown == nil {
+			t.render()
+		}
 	})
 }
 
-func (t *Table) updateColumns() {
+func (t *Table) UpdateStatus(status *k8s.Status) {
+	t.app.QueueUpdateDraw(func() {
+		t.statusBar.SetText(t.formatStatus(status))
+	})
+}
+
+func (t *Table) formatStatus(status *k8s.Status) string {
+	text := "Last refresh: "
+	if status.LastRefreshTs.IsZero() {
+		text += "never"
+	} else {
+		text += status.LastRefreshTs.Format(STATUS_TIME_FORMAT)
+	}
+	text += fmt.Sprintf(" (took %s)", status.TickDuration.Round(time.Millisecond))
+
+	if status.FallbackFrom != "" {
+		text += fmt.Sprintf(" | [yellow]Source: %s (%s forbidden)[-]", status.Source, status.FallbackFrom)
+	} else if status.Source != "" {
+		text += fmt.Sprintf(" | Source: %s", status.Source)
+	}
+
+	if status.Source.ScrapesNodes() {
+		text += fmt.Sprintf(" | Nodes: %d (%d scraped", status.Nodes, status.NodesScraped)
+		if status.NodesFailed > 0 {
+			text += fmt.Sprintf(", [red]%d failed[-]", status.NodesFailed)
+		}
+		text += ")"
+	}
+
+	if status.ParseWarnings > 0 {
+		text += fmt.Sprintf(" | [yellow]%d parse warnings[-]", status.ParseWarnings)
+	}
+
+	if churn := status.LastNodeChurn; churn != nil {
+		text += fmt.Sprintf(" | Node churn (%s): [green]+%d[-] [yellow]-%d[-]",
+			churn.Ts.Format(STATUS_TIME_FORMAT),
+			len(churn.Added),
+			len(churn.Removed),
+		)
+	}
+
+	if status.LastError != nil {
+		text += fmt.Sprintf(" | [red]Error (%s): %s[-]",
+			status.LastErrorTs.Format(STATUS_TIME_FORMAT),
+			tview.Escape(status.LastError.Error()),
+		)
+	}
+	return text
+}
+
+// updateHistoryLength fits the sparklines to the longest history of the shown rows
+func (t *Table) updateHistoryLength(stats []*k8s.Stats) {
+	t.historyLength = 0
+	for _, stat := range stats {
+		if len(stat.CpuHistory) > t.historyLength {
+			t.historyLength = len(stat.CpuHistory)
+		}
+	}
+}
+
+func (t *Table) updateColumns(columns []string) {
 	blue := tcell.ColorBlue
-	t.table.SetCell(0, 0, t.createColumnCell("Namespace").SetTextColor(blue))
-	t.table.SetCell(0, 1, t.createColumnCell("Pod").SetTextColor(blue))
-	t.table.SetCell(0, 2, t.createColumnCell("Container").SetTextColor(blue))
-	t.table.SetCell(0, 3, t.createColumnCell("CPU").SetTextColor(blue))
-	t.table.SetCell(0, 4, t.createColumnCell("Memory").SetTextColor(blue))
+	for i, column := range columns {
+		t.table.SetCell(0, i, t.createColumnCell(t.getColumnTitle(column)).SetTextColor(blue))
+	}
+}
+
+func (t *Table) getColumnTitle(column string) string {
+	if title, ok := columnTitles[column]; ok {
+		return title
+	}
+	return t.catalog.Metric(column).Display
 }
 
 func (t *Table) createColumnCell(text string) *tview.TableCell {
 	return tview.NewTableCell(text).SetAlign(tview.AlignCenter).SetTextColor(tcell.ColorBlue).SetBackgroundColor(tcell.ColorDarkGray)
 }
 
-func (t *Table) getCell(stats *k8s.Stats, column int) *tview.TableCell {
+func (t *Table) getCell(stats *k8s.Stats, column string) *tview.TableCell {
 	switch column {
-	case 0:
+	case COLUMN_CLUSTER:
+		return tview.NewTableCell(stats.Cluster)
+	case COLUMN_NAMESPACE:
 		return tview.NewTableCell(stats.Namespace)
-	case 1:
+	case COLUMN_WORKLOAD:
+		return tview.NewTableCell(stats.Workload)
+	case COLUMN_NODE:
+		return tview.NewTableCell(stats.NodeName)
+	case COLUMN_POD:
 		return tview.NewTableCell(stats.PodName)
-	case 2:
+	case COLUMN_CONTAINER:
 		return tview.NewTableCell(stats.ContainerName)
-	case 3:
+	case COLUMN_CPU:
 		if stats.CpuUsageMilli <= 0 {
 			return tview.NewTableCell("\u23F1").SetAlign(tview.AlignCenter)
 		}
 		if stats.CpuUsagePercent > 0 {
 			color := t.getCellColor(stats.CpuUsagePercent)
-			return tview.NewTableCell(fmt.Sprintf("%.0f/%.0fmCPU (%.1f%%)", stats.CpuUsageMilli, stats.CpuLimit, stats.CpuUsagePercent)).SetTextColor(color)
+			return t.getSparklineCell(fmt.Sprintf("%.0f/%.0fmCPU (%.1f%%)", stats.CpuUsageMilli, stats.CpuLimit, stats.CpuUsagePercent), stats.CpuHistory).SetTextColor(color)
 		}
-		return tview.NewTableCell(fmt.Sprintf("%.0fmCPU", stats.CpuUsageMilli))
-	case 4:
+		return t.getSparklineCell(fmt.Sprintf("%.0fmCPU", stats.CpuUsageMilli), stats.CpuHistory)
+	case COLUMN_MEMORY:
 		if stats.MemoryBytes <= 0 {
 			return tview.NewTableCell("\u23F1").SetAlign(tview.AlignCenter)
 		}
@@ -90,11 +322,115 @@ func (t *Table) getCell(stats *k8s.Stats, column int) *tview.TableCell {
 		memoryLimitInMib := stats.MemoryLimitBytes / 1024 / 1024
 		if stats.MemoryUsagePercent > 0 {
 			color := t.getCellColor(stats.MemoryUsagePercent)
-			return tview.NewTableCell(fmt.Sprintf("%.0f/%.0fMiB (%.1f%%)", memoryInMiB, memoryLimitInMib, stats.MemoryUsagePercent)).SetTextColor(color)
+			return t.getSparklineCell(fmt.Sprintf("%.0f/%.0fMiB (%.1f%%)", memoryInMiB, memoryLimitInMib, stats.MemoryUsagePercent), stats.MemoryHistory).SetTextColor(color)
 		}
-		return tview.NewTableCell(fmt.Sprintf("%.0fMiB/-", memoryInMiB))
+		return t.getSparklineCell(fmt.Sprintf("%.0fMiB/-", memoryInMiB), stats.MemoryHistory)
+	case COLUMN_THROTTLING:
+		if stats.CpuLimit <= 0 {
+			return tview.NewTableCell("-").SetAlign(tview.AlignCenter)
+		}
+		color := t.getThrottlingColor(stats.CpuThrottledPercent)
+		return tview.NewTableCell(fmt.Sprintf("%.1f%% (%.2fs)", stats.CpuThrottledPercent, stats.CpuThrottledSeconds)).SetTextColor(color)
+	case COLUMN_CPU_REQ:
+		if stats.CpuUsageMilli <= 0 {
+			return tview.NewTableCell("\u23F1").SetAlign(tview.AlignCenter)
+		}
+		if stats.CpuRequest <= 0 {
+			return tview.NewTableCell(fmt.Sprintf("%.0fmCPU/-", stats.CpuUsageMilli))
+		}
+		return t.getRequestCell(fmt.Sprintf("%.0f/%.0fmCPU", stats.CpuUsageMilli, stats.CpuRequest), stats.CpuRequestPercent)
+	case COLUMN_MEM_REQ:
+		if stats.MemoryBytes <= 0 {
+			return tview.NewTableCell("\u23F1").SetAlign(tview.AlignCenter)
+		}
+		//convet bytes to MiB
+		memoryInMiB := stats.MemoryBytes / 1024 / 1024
+		if stats.MemoryRequestBytes <= 0 {
+			return tview.NewTableCell(fmt.Sprintf("%.0fMiB/-", memoryInMiB))
+		}
+		return t.getRequestCell(fmt.Sprintf("%.0f/%.0fMiB", memoryInMiB, stats.MemoryRequestBytes/1024/1024), stats.MemoryRequestPercent)
+	case COLUMN_CPU_USER:
+		return t.getCpuCell(stats, stats.CpuUserMilli)
+	case COLUMN_CPU_SYSTEM:
+		return t.getCpuCell(stats, stats.CpuSystemMilli)
+	case COLUMN_MEM_USAGE:
+		return t.getMemoryCell(stats, stats.MemoryUsageBytes)
+	case COLUMN_MEM_WSS:
+		return t.getMemoryCell(stats, stats.MemoryWorkingSetBytes)
+	case COLUMN_MEM_RSS:
+		return t.getMemoryCell(stats, stats.MemoryRssBytes)
+	case COLUMN_MEM_CACHE:
+		return t.getMemoryCell(stats, stats.MemoryCacheBytes)
+	case COLUMN_NET_RX:
+		return tview.NewTableCell(fmt.Sprintf("%s (%.0fp/s)", formatBytesRate(stats.NetworkRxBytesPerSec), stats.NetworkRxPacketsPerSec))
+	case COLUMN_NET_TX:
+		return tview.NewTableCell(fmt.Sprintf("%s (%.0fp/s)", formatBytesRate(stats.NetworkTxBytesPerSec), stats.NetworkTxPacketsPerSec))
+	case COLUMN_NET_DROPS:
+		dropped := stats.NetworkDroppedPerSec()
+		color := tcell.ColorWhite
+		if dropped > 0 {
+			color = tcell.ColorRed
+		}
+		return tview.NewTableCell(fmt.Sprintf("%.1fp/s", dropped)).SetTextColor(color)
+	case COLUMN_FS_READS:
+		return tview.NewTableCell(formatBytesRate(stats.FsReadBytesPerSec))
+	case COLUMN_FS_WRITES:
+		return tview.NewTableCell(formatBytesRate(stats.FsWriteBytesPerSec))
+	case COLUMN_FS_USAGE:
+		//convet bytes to MiB
+		return tview.NewTableCell(fmt.Sprintf("%.0fMiB", stats.FsUsageBytes/1024/1024))
 	default:
-		return nil
+		return t.getMetricCell(stats, t.catalog.Metric(column))
+	}
+}
+
+// getSparklineCell prefixes the text with a sparkline of the history. The sparklines are
+// padded to the same width, so that the latest samples of all rows line up
+func (t *Table) getSparklineCell(text string, history []float64) *tview.TableCell {
+	if t.historyLength < 2 {
+		return tview.NewTableCell(text)
+	}
+	padding := strings.Repeat(" ", t.historyLength-len(history))
+	return tview.NewTableCell(padding + sparkline(history) + " " + text)
+}
+
+func (t *Table) getCpuCell(stats *k8s.Stats, cpuMilli float64) *tview.TableCell {
+	if stats.CpuUsageMilli <= 0 {
+		return tview.NewTableCell("\u23F1").SetAlign(tview.AlignCenter)
+	}
+	return tview.NewTableCell(fmt.Sprintf("%.0fmCPU", cpuMilli))
+}
+
+// getMemoryCell shows the memory metric of the column, which is missing until it is
+// sampled and for the metrics which the metrics source does not report, e.g. metrics-server
+func (t *Table) getMemoryCell(stats *k8s.Stats, memoryBytes float64) *tview.TableCell {
+	if memoryBytes <= 0 {
+		return tview.NewTableCell("\u23F1").SetAlign(tview.AlignCenter)
+	}
+	//convet bytes to MiB
+	return tview.NewTableCell(fmt.Sprintf("%.0fMiB", memoryBytes/1024/1024))
+}
+
+// getMetricCell formats a catalog metric according to its unit, counters are shown per second
+func (t *Table) getMetricCell(stats *k8s.Stats, metric *k8s.MetricDefinition) *tview.TableCell {
+	value, ok := stats.Metrics[metric.Key]
+	if !ok {
+		return tview.NewTableCell("-").SetAlign(tview.AlignCenter)
+	}
+
+	isCounter := metric.Kind == k8s.METRIC_KIND_COUNTER
+	switch {
+	case metric.Unit == k8s.METRIC_UNIT_BYTES && isCounter:
+		return tview.NewTableCell(formatBytesRate(value))
+	case metric.Unit == k8s.METRIC_UNIT_BYTES:
+		//convet bytes to MiB
+		return tview.NewTableCell(fmt.Sprintf("%.0fMiB", value/1024/1024))
+	case metric.Unit == k8s.METRIC_UNIT_CORES && isCounter:
+		return tview.NewTableCell(fmt.Sprintf("%.0fmCPU", value*1000))
+	case isCounter:
+		return tview.NewTableCell(strings.TrimSpace(fmt.Sprintf("%.2f %s/s", value, metric.Unit)))
+	default:
+		return tview.NewTableCell(strings.TrimSpace(fmt.Sprintf("%.2f %s", value, metric.Unit)))
 	}
 }
 
@@ -109,3 +445,61 @@ func (t *Table) getCellColor(utilization float64) tcell.Color {
 
 	return tcell.ColorWhite
 }
+
+// getRequestCell marks containers using more than they requested, which the scheduler
+// did not account for and which are the first to be evicted or starved under pressure
+func (t *Table) getRequestCell(text string, percent float64) *tview.TableCell {
+	color := tcell.ColorWhite
+	if percent > 100 {
+		color = tcell.ColorYellow
+	}
+	return tview.NewTableCell(fmt.Sprintf("%s (%.1f%%)", text, percent)).SetTextColor(color)
+}
+
+// getThrottlingColor uses lower thresholds than getCellColor,
+// since even a small share of throttled periods hurts latency
+func (t *Table) getThrottlingColor(throttledPercent float64) tcell.Color {
+	if throttledPercent > 25 {
+		return tcell.ColorRed
+	}
+
+	if throttledPercent > 5 {
+		return tcell.ColorYellow
+	}
+
+	return tcell.ColorWhite
+}
+
+var sparklineBars = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline draws the values scaled from 0 to their maximum, so a spike stands
+// out against a mostly low line while a steady load draws a flat high line
+func sparkline(values []float64) string {
+	max := 0.0
+	for _, value := range values {
+		if value > max {
+			max = value
+		}
+	}
+
+	bars := make([]rune, len(values))
+	for i, value := range values {
+		bar := 0
+		if max > 0 {
+			bar = int(math.Round(value / max * float64(len(sparklineBars)-1)))
+		}
+		bars[i] = sparklineBars[bar]
+	}
+	return string(bars)
+}
+
+func formatBytesRate(bytesPerSec float64) string {
+	switch {
+	case bytesPerSec >= 1024*1024:
+		return fmt.Sprintf("%.1fMiB/s", bytesPerSec/1024/1024)
+	case bytesPerSec >= 1024:
+		return fmt.Sprintf("%.1fKiB/s", bytesPerSec/1024)
+	default:
+		return fmt.Sprintf("%.0fB/s", bytesPerSec)
+	}
+}